@@ -0,0 +1,263 @@
+// Package admin manages the watched channels while the bot is running.
+// Changes are applied to the running source consumers through the supervisor
+// and saved to the configuration file, so they survive restarts.
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"tg_alarm_bot/config"
+	"tg_alarm_bot/filter"
+	"tg_alarm_bot/lib/e"
+	tg_sources "tg_alarm_bot/sources/telegram"
+	"tg_alarm_bot/supervisor"
+)
+
+var (
+	// ErrUnknownSource is returned when a source with the given name doesn't exist.
+	ErrUnknownSource = errors.New("unknown source")
+	// ErrSourceExists is returned when a source with the given name already exists.
+	ErrSourceExists = errors.New("source already exists")
+)
+
+// channelName matches the valid names of public Telegram channels.
+var channelName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{3,31}$`)
+
+// StartFunc creates the consumer of a source and adds it to the supervisor, paused if the source is paused.
+type StartFunc func(s tg_sources.Source) error
+
+// Manager adds, removes, pauses and reconfigures the sources of a running bot.
+// It is safe for concurrent use.
+type Manager struct {
+	mu    sync.Mutex
+	cfg   *config.Config
+	path  string
+	sup   *supervisor.Supervisor
+	start StartFunc
+}
+
+// New creates a new Manager of the sources of cfg, which was loaded from the file at path.
+// The consumers of the sources are run by sup and created by start.
+func New(cfg *config.Config, path string, sup *supervisor.Supervisor, start StartFunc) *Manager {
+	return &Manager{
+		cfg:   cfg,
+		path:  path,
+		sup:   sup,
+		start: start,
+	}
+}
+
+// IsAdmin reports whether the user is allowed to manage the sources.
+func (m *Manager) IsAdmin(userID int) bool {
+	return userID != 0 && slices.Contains(m.cfg.Admins, userID)
+}
+
+// Sources returns a copy of the current sources.
+func (m *Manager) Sources() []tg_sources.Source {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.cfg.Sources)
+}
+
+// Split splits the arguments of a command into the name of a source and the rest of the arguments.
+// Source names may contain spaces, so the longest name the arguments start with is picked.
+func (m *Manager) Split(args []string) (string, []string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for n := len(args); n > 0; n-- {
+		name := strings.Join(args[:n], " ")
+		if m.index(name) >= 0 {
+			return name, args[n:], true
+		}
+	}
+
+	return "", args, false
+}
+
+// AddSource starts watching the channel under the given name, forwarding the messages matching the shared rule
+// to the chat, and saves the configuration. The channel is given by its name, "@name" or link.
+func (m *Manager) AddSource(name, channel string, chatID int, rule string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.index(name) >= 0 {
+		return fmt.Errorf("%w: %s", ErrSourceExists, name)
+	}
+
+	u, err := channelURL(channel)
+	if err != nil {
+		return err
+	}
+
+	s := tg_sources.Source{
+		Name:         name,
+		URL:          u,
+		Rule:         rule,
+		Destinations: []tg_sources.Destination{{ChatID: chatID}},
+	}
+
+	// The source is validated by creating its consumer.
+	if err := m.start(s); err != nil {
+		return e.Wrap("can't add source", err)
+	}
+
+	m.cfg.Sources = append(m.cfg.Sources, s)
+
+	return m.save()
+}
+
+// RemoveSource stops watching the source and saves the configuration.
+func (m *Manager) RemoveSource(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+
+	if err := m.sup.Remove(name); err != nil {
+		return e.Wrap("can't remove source", err)
+	}
+
+	m.cfg.Sources = slices.Delete(m.cfg.Sources, i, i+1)
+
+	return m.save()
+}
+
+// Pause stops polling the source until it is resumed and saves the configuration.
+func (m *Manager) Pause(name string) error {
+	return m.setPaused(name, true)
+}
+
+// Resume starts polling the paused source again and saves the configuration.
+func (m *Manager) Resume(name string) error {
+	return m.setPaused(name, false)
+}
+
+// setPaused pauses or resumes the source and saves the configuration.
+func (m *Manager) setPaused(name string, paused bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+
+	var err error
+	if paused {
+		err = m.sup.Pause(name)
+	} else {
+		err = m.sup.Resume(name)
+	}
+
+	if err != nil {
+		return e.Wrap("can't pause or resume source", err)
+	}
+
+	m.cfg.Sources[i].Paused = paused
+
+	return m.save()
+}
+
+// SetRegexp makes the source select alerts by the regular expression instead of its rule,
+// restarts the consumer of the source and saves the configuration.
+func (m *Manager) SetRegexp(name, expr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+
+	if _, err := regexp.Compile(expr); err != nil {
+		return e.Wrap("can't set regexp", err)
+	}
+
+	old := m.cfg.Sources[i]
+
+	s := old
+	s.SearchRegexp, s.Rule = expr, ""
+
+	if err := m.sup.Remove(name); err != nil {
+		return e.Wrap("can't set regexp", err)
+	}
+
+	if err := m.start(s); err != nil {
+		// Keep the source running with its previous settings.
+		if restoreErr := m.start(old); restoreErr != nil {
+			err = errors.Join(err, restoreErr)
+		}
+
+		return e.Wrap("can't set regexp", err)
+	}
+
+	m.cfg.Sources[i] = s
+
+	return m.save()
+}
+
+// TestRegexp returns the decision the filter of the source makes about the text.
+func (m *Manager) TestRegexp(name, text string) (filter.Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(name)
+	if i < 0 {
+		return filter.Decision{}, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+
+	f, err := m.cfg.Filter(m.cfg.Sources[i])
+	if err != nil {
+		return filter.Decision{}, e.Wrap("can't test regexp", err)
+	}
+
+	return f.Decide(text), nil
+}
+
+// index returns the index of the source with the given name, or -1 if there is none. The caller must hold the lock.
+func (m *Manager) index(name string) int {
+	return slices.IndexFunc(m.cfg.Sources, func(s tg_sources.Source) bool { return s.Name == name })
+}
+
+// save writes the configuration to its file. The caller must hold the lock.
+func (m *Manager) save() error {
+	if err := m.cfg.Save(m.path); err != nil {
+		return fmt.Errorf("applied, but %w", err)
+	}
+
+	return nil
+}
+
+// channelURL returns the URL of the preview page of a public channel given by its name, "@name" or link.
+func channelURL(channel string) (string, error) {
+	name := strings.TrimPrefix(channel, "@")
+
+	if strings.Contains(channel, "t.me/") {
+		if !strings.Contains(channel, "://") {
+			channel = "https://" + channel
+		}
+
+		u, err := url.Parse(channel)
+		if err != nil || u.Host != "t.me" {
+			return "", fmt.Errorf("invalid channel link: %s", channel)
+		}
+
+		name = strings.TrimPrefix(strings.Trim(u.Path, "/"), "s/")
+	}
+
+	if !channelName.MatchString(name) {
+		return "", fmt.Errorf("invalid channel name: %s", name)
+	}
+
+	return "https://t.me/s/" + name, nil
+}
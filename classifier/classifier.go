@@ -0,0 +1,190 @@
+// Package classifier tags alert messages with the type of the threat they announce and its severity.
+// Classification is keyword based: the first threat type, in order of decreasing danger,
+// whose keywords occur in the message wins.
+package classifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"tg_alarm_bot/filter"
+)
+
+// Threat is the type of a threat announced by a message.
+type Threat string
+
+const (
+	// Unknown is a threat that could not be recognized.
+	Unknown Threat = "unknown"
+	// AllClear announces that a threat is over.
+	AllClear Threat = "all_clear"
+	// Ballistic is a ballistic missile.
+	Ballistic Threat = "ballistic"
+	// Cruise is a cruise missile.
+	Cruise Threat = "cruise_missile"
+	// GuidedBomb is a guided aerial bomb (KAB).
+	GuidedBomb Threat = "guided_bomb"
+	// Shahed is a Shahed-type attack drone.
+	Shahed Threat = "shahed"
+	// Artillery is artillery or rocket artillery shelling.
+	Artillery Threat = "artillery"
+)
+
+// Severity is the level of danger of a threat.
+type Severity int
+
+const (
+	// Low is the severity of messages that need no immediate action.
+	Low Severity = iota
+	// Medium is the severity of threats that may reach the area.
+	Medium
+	// High is the severity of fast threats that leave little time to take cover.
+	High
+	// Critical is the severity of threats that leave almost no time to take cover.
+	Critical
+)
+
+// severityNames maps severities to their names used in the configuration.
+var severityNames = []string{"low", "medium", "high", "critical"}
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	if s < Low || s > Critical {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+
+	return severityNames[s]
+}
+
+// MarshalJSON encodes the severity as its name.
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON decodes the severity from its name.
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	for i, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown severity %q", name)
+}
+
+// Classification is the result of classifying a message.
+type Classification struct {
+	Threat   Threat   `json:"threat"`   // Type of the threat.
+	Severity Severity `json:"severity"` // Severity of the threat.
+	Label    string   `json:"label"`    // Label the forwarded message is prefixed with.
+	Silent   bool     `json:"silent"`   // Whether the message should be sent without a notification.
+}
+
+// ThreatConfig overrides the presentation and severity of a threat type.
+type ThreatConfig struct {
+	Label    *string   `json:"label,omitempty"`    // Emoji or text the message is prefixed with; empty to disable.
+	Severity *Severity `json:"severity,omitempty"` // Severity of the threat type.
+}
+
+// Config configures the classifier.
+type Config struct {
+	Threats     map[Threat]ThreatConfig `json:"threats,omitempty"`      // Overrides per threat type.
+	SilentBelow *Severity               `json:"silent_below,omitempty"` // Messages with a lower severity are sent silently; medium if unset.
+}
+
+// class describes a threat type: its default presentation and the keywords it is recognized by.
+// Keywords are matched like the keywords of rules (see package filter): by the stems of whole words,
+// by the beginning of a word if they end with "*", or as a phrase if they consist of several words.
+type class struct {
+	threat   Threat
+	label    string
+	severity Severity
+	keywords []string
+}
+
+// classes lists the known threat types in the order they are checked.
+var classes = []class{
+	{AllClear, "✅", Low, []string{"відбій", "отбой", "загроза минула", "угроза миновала"}},
+	{Ballistic, "☄️", Critical, []string{"балістик*", "баллистик*", "іскандер*", "искандер*", "кн-23", "kn-23", "кинджал*", "кинжал*"}},
+	{GuidedBomb, "💣", High, []string{"каб", "каби", "кабів", "кабами", "кабы", "керован*", "авіабомб*", "авиабомб*", "фаб", "фаб-250", "фаб-500", "фаб-1500", "фаб-3000", "уміпк", "умпк"}},
+	{Cruise, "🚀", High, []string{"крилат*", "крылат*", "калібр*", "калибр*", "х-101", "х-59", "х-22", "х-69", "швидкісн*", "скоростн*", "ракет*"}},
+	{Shahed, "🛵", Medium, []string{"шахед*", "шахєд*", "мопед*", "герань*", "герані*", "герани*", "бпла", "дрон*", "гербер*"}},
+	{Artillery, "💥", Medium, []string{"артилер*", "артиллер*", "арта", "обстріл*", "обстрел*", "міномет*", "миномет*", "рсзв", "ствольн*"}},
+}
+
+// matchers holds the compiled keywords of the classes by their threat types.
+var matchers = compile(classes)
+
+// Classifier classifies messages by the threat they announce.
+type Classifier struct {
+	cfg Config
+}
+
+// New creates a Classifier with the given configuration.
+func New(cfg Config) *Classifier {
+	return &Classifier{cfg: cfg}
+}
+
+// Classify returns the classification of the text.
+func (c *Classifier) Classify(text string) Classification {
+	for _, cl := range classes {
+		if matchers[cl.threat].Match(text).Matched {
+			return c.classification(cl)
+		}
+	}
+
+	return c.classification(class{threat: Unknown, label: "⚠️", severity: Medium})
+}
+
+// classification applies the configured overrides to a class.
+func (c *Classifier) classification(cl class) Classification {
+	res := Classification{Threat: cl.threat, Severity: cl.severity, Label: cl.label}
+
+	if o, ok := c.cfg.Threats[cl.threat]; ok {
+		if o.Label != nil {
+			res.Label = *o.Label
+		}
+		if o.Severity != nil {
+			res.Severity = *o.Severity
+		}
+	}
+
+	silentBelow := Medium
+	if c.cfg.SilentBelow != nil {
+		silentBelow = *c.cfg.SilentBelow
+	}
+
+	res.Silent = res.Severity < silentBelow
+
+	return res
+}
+
+// compile compiles the keywords of every class into a matcher of any of them.
+// It panics if a keyword can't be compiled, since the keywords are fixed.
+func compile(classes []class) map[Threat]filter.Matcher {
+	rules := make(map[string]filter.Rule, len(classes))
+	for _, cl := range classes {
+		rules[string(cl.threat)] = filter.Rule{AnyOf: cl.keywords}
+	}
+
+	en, err := filter.New(rules)
+	if err != nil {
+		panic(err)
+	}
+
+	res := make(map[Threat]filter.Matcher, len(classes))
+
+	for _, cl := range classes {
+		if res[cl.threat], err = en.Matcher(string(cl.threat)); err != nil {
+			panic(err)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,45 @@
+package classifier
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		text string
+		want Threat
+	}{
+		{"Балістика на Суми!", Ballistic},
+		{"Пуски КАБів на Сумщину", GuidedBomb},
+		{"Скидають ФАБ-500 на Краснопілля", GuidedBomb},
+		{"Летять фаби", GuidedBomb},
+		{"Пожежа на фабриці в Сумах", Unknown},
+		{"Фабричний район, увага", Unknown},
+		{"Швидкісна ціль курсом на Суми", Cruise},
+		{"Ракета Х-101 над областю", Cruise},
+		{"Шахеди з півночі", Shahed},
+		{"Група БпЛА над Конотопом", Shahed},
+		{"Обстріл Білопілля", Artillery},
+		{"Відбій тривоги", AllClear},
+		{"Увага, тривога", Unknown},
+	}
+
+	c := New(Config{})
+
+	for _, tt := range tests {
+		if got := c.Classify(tt.text); got.Threat != tt.want {
+			t.Errorf("Classify(%q) = %s, want %s", tt.text, got.Threat, tt.want)
+		}
+	}
+}
+
+func TestClassifySilent(t *testing.T) {
+	high := High
+	c := New(Config{SilentBelow: &high})
+
+	if got := c.Classify("Шахеди з півночі"); !got.Silent || got.Severity != Medium {
+		t.Errorf("Classify() = %+v, want silent medium severity", got)
+	}
+
+	if got := c.Classify("Балістика!"); got.Silent {
+		t.Errorf("Classify() = %+v, want not silent", got)
+	}
+}
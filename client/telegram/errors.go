@@ -0,0 +1,47 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned by the client methods when the Telegram Bot API rejects a request.
+// It carries the error code and description reported by the API along with the retry_after
+// parameter that is set when the request was rate limited.
+type APIError struct {
+	Method      string // API method that failed.
+	Code        int    // Error code reported by the API, usually matching the HTTP status.
+	Description string // Human-readable description of the error.
+	RetryAfter  int    // Number of seconds to wait before repeating the request, if rate limited.
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("telegram api %s: %d %s (retry after %ds)", e.Method, e.Code, e.Description, e.RetryAfter)
+	}
+
+	return fmt.Sprintf("telegram api %s: %d %s", e.Method, e.Code, e.Description)
+}
+
+// Temporary reports whether repeating the request later may succeed.
+func (e *APIError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= http.StatusInternalServerError
+}
+
+// Blocked reports whether the bot can't send messages to the chat anymore,
+// e.g. because the user blocked the bot or the bot was removed from the chat.
+func (e *APIError) Blocked() bool {
+	return e.Code == http.StatusForbidden
+}
+
+// AsAPIError returns the APIError wrapped in err, if any.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,89 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"tg_alarm_bot/lib/e"
+)
+
+const (
+	// answerCallbackQueryMethod is the API method name for answering the presses of inline buttons.
+	answerCallbackQueryMethod = "answerCallbackQuery"
+	// editMessageReplyMarkupMethod is the API method name for replacing the inline keyboard of sent messages.
+	editMessageReplyMarkupMethod = "editMessageReplyMarkup"
+)
+
+// MaxCallbackData is the maximum length of the callback data of an inline button in bytes.
+const MaxCallbackData = 64
+
+// InlineKeyboardMarkup is an inline keyboard attached to a message.
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// InlineKeyboardButton is a button of an inline keyboard. Exactly one of CallbackData and URL must be set.
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+// CallbackQuery represents the press of an inline button.
+// Message is the message with the button, which is nil if the message is too old.
+type CallbackQuery struct {
+	ID      string           `json:"id"`
+	From    From             `json:"from"`
+	Message *IncomingMessage `json:"message"`
+	Data    string           `json:"data"`
+}
+
+// AnswerCallbackQuery answers the press of an inline button identified by callbackID, which stops
+// the progress indicator on the button. If text is not empty, it is shown to the user as a notification,
+// or as an alert if showAlert is set.
+func (c *Client) AnswerCallbackQuery(ctx context.Context, callbackID, text string, showAlert bool) error {
+	q := url.Values{}
+	q.Add("callback_query_id", callbackID)
+
+	if text != "" {
+		q.Add("text", text)
+	}
+
+	if showAlert {
+		q.Add("show_alert", "true")
+	}
+
+	if _, err := c.doRequest(ctx, answerCallbackQueryMethod, q); err != nil {
+		return e.Wrap("can't answer callback query", err)
+	}
+
+	return nil
+}
+
+// EditMessageReplyMarkup replaces the inline keyboard of the message with the given ID in the chat identified by chatID.
+// A nil markup removes the keyboard. Edits count against the rate limit of the chat.
+func (c *Client) EditMessageReplyMarkup(ctx context.Context, chatID, messageID int, markup *InlineKeyboardMarkup) error {
+	q := url.Values{}
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add("message_id", strconv.Itoa(messageID))
+	SendOptions{ReplyMarkup: markup}.apply(q)
+
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return e.Wrap("can't edit message reply markup", err)
+	}
+
+	if _, err := c.doRequest(ctx, editMessageReplyMarkupMethod, q); err != nil {
+		return e.Wrap("can't edit message reply markup", err)
+	}
+
+	return nil
+}
+
+// encode returns the JSON encoding of the markup.
+func (m *InlineKeyboardMarkup) encode() string {
+	// Marshaling can't fail, since the markup holds only strings.
+	data, _ := json.Marshal(m)
+
+	return string(data)
+}
@@ -0,0 +1,120 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits documented by Telegram for bots sending messages.
+const (
+	// globalLimit is the number of messages per globalPeriod the bot may send across all chats.
+	globalLimit  = 30
+	globalPeriod = time.Second
+	// chatLimit is the number of messages per chatPeriod the bot may send to a single chat.
+	chatLimit  = 1
+	chatPeriod = time.Second
+	// groupLimit is the number of messages per groupPeriod the bot may send to a single group or channel.
+	groupLimit  = 20
+	groupPeriod = time.Minute
+)
+
+// limiter throttles outgoing messages so that the bot stays within the limits of the Telegram Bot API.
+// A message is let through only when it fits into the global window, the window of its chat
+// and, for groups and channels, the per-group window.
+type limiter struct {
+	mu     sync.Mutex
+	global *window
+	chats  map[int]*window
+	groups map[int]*window
+}
+
+// window is a sliding window that allows at most limit events within period.
+type window struct {
+	limit  int
+	period time.Duration
+	times  []time.Time
+}
+
+// newLimiter creates a limiter with the limits documented by Telegram.
+func newLimiter() *limiter {
+	return &limiter{
+		global: &window{limit: globalLimit, period: globalPeriod},
+		chats:  make(map[int]*window),
+		groups: make(map[int]*window),
+	}
+}
+
+// wait blocks until a message may be sent to the chat or the context is done.
+func (l *limiter) wait(ctx context.Context, chatID int) error {
+	for {
+		delay := l.take(chatID, time.Now())
+		if delay <= 0 {
+			return nil
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// take records a message to the chat at now if it fits into all the windows and returns zero.
+// Otherwise, nothing is recorded and the time to wait before trying again is returned.
+func (l *limiter) take(chatID int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	windows := []*window{l.global, l.window(l.chats, chatID, chatLimit, chatPeriod)}
+
+	// Group and channel IDs are negative, private chats have positive IDs.
+	if chatID < 0 {
+		windows = append(windows, l.window(l.groups, chatID, groupLimit, groupPeriod))
+	}
+
+	var delay time.Duration
+
+	for _, w := range windows {
+		if d := w.delay(now); d > delay {
+			delay = d
+		}
+	}
+
+	if delay > 0 {
+		return delay
+	}
+
+	for _, w := range windows {
+		w.times = append(w.times, now)
+	}
+
+	return 0
+}
+
+// window returns the window of the chat from m, creating it if necessary.
+func (l *limiter) window(m map[int]*window, chatID int, limit int, period time.Duration) *window {
+	w, ok := m[chatID]
+	if !ok {
+		w = &window{limit: limit, period: period}
+		m[chatID] = w
+	}
+
+	return w
+}
+
+// delay drops the events that left the window and returns how long to wait
+// until another event fits into the window.
+func (w *window) delay(now time.Time) time.Duration {
+	i := 0
+	for i < len(w.times) && now.Sub(w.times[i]) >= w.period {
+		i++
+	}
+
+	w.times = w.times[i:]
+
+	if len(w.times) < w.limit {
+		return 0
+	}
+
+	return w.times[len(w.times)-w.limit].Add(w.period).Sub(now)
+}
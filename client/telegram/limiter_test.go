@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterChatWindow(t *testing.T) {
+	l := newLimiter()
+	now := time.Now()
+
+	if d := l.take(1, now); d != 0 {
+		t.Fatalf("first message delayed by %v", d)
+	}
+
+	if d := l.take(1, now.Add(200*time.Millisecond)); d != 800*time.Millisecond {
+		t.Errorf("second message to the chat delayed by %v, want 800ms", d)
+	}
+
+	// Other chats are not affected by the window of the chat.
+	if d := l.take(2, now.Add(200*time.Millisecond)); d != 0 {
+		t.Errorf("message to another chat delayed by %v", d)
+	}
+
+	if d := l.take(1, now.Add(chatPeriod)); d != 0 {
+		t.Errorf("message after the window delayed by %v", d)
+	}
+}
+
+func TestLimiterGroupWindow(t *testing.T) {
+	l := newLimiter()
+	now := time.Now()
+
+	for i := 0; i < groupLimit; i++ {
+		if d := l.take(-100, now.Add(time.Duration(i)*chatPeriod)); d != 0 {
+			t.Fatalf("message %d to the group delayed by %v", i, d)
+		}
+	}
+
+	at := now.Add(groupLimit * chatPeriod)
+	if d, want := l.take(-100, at), now.Add(groupPeriod).Sub(at); d != want {
+		t.Errorf("message over the group limit delayed by %v, want %v", d, want)
+	}
+
+	// Private chats have no group window.
+	for i := 0; i < groupLimit+1; i++ {
+		if d := l.take(100, now.Add(time.Duration(i)*chatPeriod)); d != 0 {
+			t.Fatalf("message %d to the private chat delayed by %v", i, d)
+		}
+	}
+}
+
+func TestLimiterGlobalWindow(t *testing.T) {
+	l := newLimiter()
+	now := time.Now()
+
+	for i := 0; i < globalLimit; i++ {
+		if d := l.take(i+1, now); d != 0 {
+			t.Fatalf("message %d delayed by %v", i, d)
+		}
+	}
+
+	if d := l.take(globalLimit+1, now); d != globalPeriod {
+		t.Errorf("message over the global limit delayed by %v, want %v", d, globalPeriod)
+	}
+
+	// A rejected message is not recorded, so it doesn't extend the windows.
+	if d := l.take(globalLimit+1, now.Add(globalPeriod)); d != 0 {
+		t.Errorf("message after the window delayed by %v", d)
+	}
+}
@@ -0,0 +1,138 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"tg_alarm_bot/lib/e"
+)
+
+const (
+	// sendPhotoMethod is the API method name for sending photos.
+	sendPhotoMethod = "sendPhoto"
+	// sendVideoMethod is the API method name for sending videos.
+	sendVideoMethod = "sendVideo"
+	// sendDocumentMethod is the API method name for sending documents.
+	sendDocumentMethod = "sendDocument"
+	// sendMediaGroupMethod is the API method name for sending albums.
+	sendMediaGroupMethod = "sendMediaGroup"
+)
+
+// Types of media.
+const (
+	MediaPhoto    = "photo"
+	MediaVideo    = "video"
+	MediaDocument = "document"
+)
+
+// MaxCaptionLength is the maximum length of a media caption in runes.
+const MaxCaptionLength = 1024
+
+// InputMedia represents a single media of an album.
+// Media is either an HTTP URL Telegram downloads the file from, or the file_id of a file already on the Telegram servers.
+type InputMedia struct {
+	Type      string `json:"type"`
+	Media     string `json:"media"`
+	Caption   string `json:"caption,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// SendPhoto sends a photo with a caption to the chat identified by chatID and returns the ID of the sent message.
+// The photo is an HTTP URL or a file_id. The parse mode of the options applies to the caption.
+func (c *Client) SendPhoto(ctx context.Context, chatID int, photo, caption string, opts SendOptions) (int, error) {
+	id, err := c.sendMedia(ctx, sendPhotoMethod, MediaPhoto, chatID, photo, caption, opts)
+	if err != nil {
+		return 0, e.Wrap("can't send photo", err)
+	}
+
+	return id, nil
+}
+
+// SendVideo sends a video with a caption to the chat identified by chatID and returns the ID of the sent message.
+// The video is an HTTP URL or a file_id. The parse mode of the options applies to the caption.
+func (c *Client) SendVideo(ctx context.Context, chatID int, video, caption string, opts SendOptions) (int, error) {
+	id, err := c.sendMedia(ctx, sendVideoMethod, MediaVideo, chatID, video, caption, opts)
+	if err != nil {
+		return 0, e.Wrap("can't send video", err)
+	}
+
+	return id, nil
+}
+
+// SendDocument sends a document with a caption to the chat identified by chatID and returns the ID of the sent message.
+// The document is an HTTP URL or a file_id. The parse mode of the options applies to the caption.
+func (c *Client) SendDocument(ctx context.Context, chatID int, document, caption string, opts SendOptions) (int, error) {
+	id, err := c.sendMedia(ctx, sendDocumentMethod, MediaDocument, chatID, document, caption, opts)
+	if err != nil {
+		return 0, e.Wrap("can't send document", err)
+	}
+
+	return id, nil
+}
+
+// SendMediaGroup sends an album of 2 to 10 photos and videos, or of documents, to the chat identified by chatID.
+// The caption of the album is the caption of its first media. The parse mode of the options applies to the captions
+// of the media that don't set their own. Every media of the album counts against the rate limit of the chat.
+// Returns the ID of the first message of the album, which carries its caption.
+func (c *Client) SendMediaGroup(ctx context.Context, chatID int, media []InputMedia, opts SendOptions) (int, error) {
+	group := make([]InputMedia, len(media))
+	for i, m := range media {
+		if m.ParseMode == "" && m.Caption != "" {
+			m.ParseMode = opts.ParseMode
+		}
+
+		group[i] = m
+	}
+
+	data, err := json.Marshal(group)
+	if err != nil {
+		return 0, e.Wrap("can't send media group", err)
+	}
+
+	q := url.Values{}
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add("media", string(data))
+	SendOptions{
+		DisableNotification: opts.DisableNotification,
+		ReplyToMessageID:    opts.ReplyToMessageID,
+		MessageThreadID:     opts.MessageThreadID,
+	}.apply(q)
+
+	for range media {
+		if err := c.limiter.wait(ctx, chatID); err != nil {
+			return 0, e.Wrap("can't send media group", err)
+		}
+	}
+
+	res, err := c.doRequest(ctx, sendMediaGroupMethod, q)
+	if err != nil {
+		return 0, e.Wrap("can't send media group", err)
+	}
+
+	var msgs []IncomingMessage
+
+	if err := json.Unmarshal(res, &msgs); err != nil || len(msgs) == 0 {
+		return 0, e.Wrap("can't send media group", fmt.Errorf("unexpected result: %s", res))
+	}
+
+	return msgs[0].ID, nil
+}
+
+// sendMedia sends a single media file passed in the field of the method and returns the ID of the sent message.
+func (c *Client) sendMedia(ctx context.Context, method, field string, chatID int, media, caption string, opts SendOptions) (int, error) {
+	q := url.Values{}
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add(field, media)
+	if caption != "" {
+		q.Add("caption", caption)
+	}
+	opts.apply(q)
+
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return 0, err
+	}
+
+	return c.sendRequest(ctx, method, q)
+}
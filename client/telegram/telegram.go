@@ -1,30 +1,56 @@
 // Package telegram provides a client for interacting with the Telegram Bot API.
-// It includes methods to fetch updates from the bot and send messages.
+// It includes methods to fetch updates from the bot, send messages and answer the presses of inline buttons.
 package telegram
 
 import (
+	"context"
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
+	"tg_alarm_bot/lib/backoff"
 	"tg_alarm_bot/lib/e"
+	"time"
 )
 
 // Client represents a client for the Telegram Bot API.
-// It holds the host, base API path, and an HTTP client.
+// It holds the host, base API path, an HTTP client and a limiter that keeps sent messages
+// within the rate limits of the API.
 type Client struct {
 	host     string
 	basePath string
 	client   http.Client
+	limiter  *limiter
 }
 
 const (
+	// getMeMethod is the API method name for fetching the account of the bot.
+	getMeMethod = "getMe"
 	// getUpdatesMethod is the API method name for fetching updates from the bot.
 	getUpdatesMethod = "getUpdates"
 	// sendMessageMethod is the API method name for sending messages through the bot.
 	sendMessageMethod = "sendMessage"
+	// editMessageTextMethod is the API method name for editing the text of sent messages.
+	editMessageTextMethod = "editMessageText"
+	// editMessageCaptionMethod is the API method name for editing the caption of sent media.
+	editMessageCaptionMethod = "editMessageCaption"
+	// deleteMessageMethod is the API method name for deleting sent messages.
+	deleteMessageMethod = "deleteMessage"
+)
+
+// MaxMessageLength is the maximum length of a message text in runes.
+const MaxMessageLength = 4096
+
+const (
+	// maxRetries is the number of times a failed request is repeated before giving up.
+	maxRetries = 5
+	// baseBackoff is the delay before the first retry of a request that failed with a network or server error.
+	baseBackoff = 500 * time.Millisecond
+	// maxBackoff caps the delay between retries.
+	maxBackoff = 30 * time.Second
 )
 
 // New creates a new Client instance with the provided host and token.
@@ -34,85 +60,246 @@ func New(host, token string) *Client {
 		host:     host,
 		basePath: newBasePath(token),
 		client:   http.Client{},
+		limiter:  newLimiter(),
 	}
 }
 
 // Updates fetches updates (messages, events) from the bot.
 // It takes an offset and limit as parameters, representing the message starting point and the number of updates to retrieve.
 // Returns a slice of Update objects or an error if the request fails.
-func (c *Client) Updates(offset, limit int) ([]Update, error) {
+func (c *Client) Updates(ctx context.Context, offset, limit int) ([]Update, error) {
 	q := url.Values{}
 	q.Add("offset", strconv.Itoa(offset))
 	q.Add("limit", strconv.Itoa(limit))
 
-	data, err := c.doRequest(getUpdatesMethod, q)
+	data, err := c.doRequest(ctx, getUpdatesMethod, q)
 	if err != nil {
 		return nil, e.Wrap("can't get updates", err)
 	}
 
-	var res UpdatesResponse
+	var res []Update
 
 	if err := json.Unmarshal(data, &res); err != nil {
 		return nil, e.Wrap("can't get updates", err)
 	}
 
-	return res.Result, nil
+	return res, nil
+}
+
+// Me fetches the account of the bot, e.g. to learn its username.
+func (c *Client) Me(ctx context.Context) (From, error) {
+	data, err := c.doRequest(ctx, getMeMethod, url.Values{})
+	if err != nil {
+		return From{}, e.Wrap("can't get bot account", err)
+	}
+
+	var res From
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return From{}, e.Wrap("can't get bot account", err)
+	}
+
+	return res, nil
 }
 
 // SendMessage sends a message to a specific chat identified by chatID.
-// It takes the chatID and the message text as parameters.
-// Returns an error if the message could not be sent.
-func (c *Client) SendMessage(chatID int, text string, parseMod string) error {
+// It takes the chatID, the message text and the options of the message as parameters.
+// The call blocks while the rate limit of the chat is exhausted.
+// Returns the ID of the sent message or an error if the message could not be sent.
+func (c *Client) SendMessage(ctx context.Context, chatID int, text string, opts SendOptions) (int, error) {
 	q := url.Values{}
 	q.Add("chat_id", strconv.Itoa(chatID))
 	q.Add("text", text)
+	opts.apply(q)
 
-	switch parseMod {
-	case "Markdown":
-		q.Add("parse_mode", "Markdown")
-	case "MarkdownV2":
-		q.Add("parse_mode", "MarkdownV2")
-	case "HTML":
-		q.Add("parse_mode", "HTML")
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return 0, e.Wrap("can't send message", err)
 	}
 
-	_, err := c.doRequest(sendMessageMethod, q)
+	id, err := c.sendRequest(ctx, sendMessageMethod, q)
 	if err != nil {
-		return e.Wrap("can't send message", err)
+		return 0, e.Wrap("can't send message", err)
+	}
+
+	return id, nil
+}
+
+// EditMessageText replaces the text of the message with the given ID in the chat identified by chatID.
+// Only the parse mode and the reply markup of the options are used.
+func (c *Client) EditMessageText(ctx context.Context, chatID, messageID int, text string, opts SendOptions) error {
+	if err := c.edit(ctx, editMessageTextMethod, "text", chatID, messageID, text, opts); err != nil {
+		return e.Wrap("can't edit message text", err)
 	}
 
 	return nil
 }
 
-// doRequest performs an HTTP request to the Telegram Bot API.
-// It constructs the URL based on the method and query parameters, and returns the response body as bytes or an error.
-func (c *Client) doRequest(method string, query url.Values) ([]byte, error) {
+// EditMessageCaption replaces the caption of the media message with the given ID in the chat identified by chatID.
+// Only the parse mode and the reply markup of the options are used.
+func (c *Client) EditMessageCaption(ctx context.Context, chatID, messageID int, caption string, opts SendOptions) error {
+	if err := c.edit(ctx, editMessageCaptionMethod, "caption", chatID, messageID, caption, opts); err != nil {
+		return e.Wrap("can't edit message caption", err)
+	}
+
+	return nil
+}
+
+// DeleteMessage deletes the message with the given ID in the chat identified by chatID.
+// Deletions count against the rate limit of the chat.
+func (c *Client) DeleteMessage(ctx context.Context, chatID, messageID int) error {
+	q := url.Values{}
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add("message_id", strconv.Itoa(messageID))
+
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return e.Wrap("can't delete message", err)
+	}
+
+	if _, err := c.doRequest(ctx, deleteMessageMethod, q); err != nil {
+		return e.Wrap("can't delete message", err)
+	}
+
+	return nil
+}
+
+// edit calls an edit method that replaces the text passed in the field of the message.
+// Edits count against the rate limit of the chat.
+func (c *Client) edit(ctx context.Context, method, field string, chatID, messageID int, text string, opts SendOptions) error {
+	q := url.Values{}
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add("message_id", strconv.Itoa(messageID))
+	q.Add(field, text)
+	SendOptions{ParseMode: opts.ParseMode, ReplyMarkup: opts.ReplyMarkup}.apply(q)
+
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return err
+	}
+
+	_, err := c.doRequest(ctx, method, q)
+
+	return err
+}
+
+// sendRequest performs a request of a method that sends a message and returns the ID of the sent message.
+func (c *Client) sendRequest(ctx context.Context, method string, query url.Values) (int, error) {
+	data, err := c.doRequest(ctx, method, query)
+	if err != nil {
+		return 0, err
+	}
+
+	var msg IncomingMessage
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return 0, err
+	}
+
+	return msg.ID, nil
+}
+
+// doRequest performs a request to the Telegram Bot API and returns the result of the method.
+// Requests rejected with 429 Too Many Requests are repeated after the delay asked by the API,
+// and requests that failed with a network or server error are repeated with a jittered exponential backoff.
+// If the request still fails after maxRetries attempts, or the API rejects it for any other reason,
+// the last error is returned; errors reported by the API are of type *APIError.
+// Retries stop as soon as the context is done.
+func (c *Client) doRequest(ctx context.Context, method string, query url.Values) (json.RawMessage, error) {
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		var res json.RawMessage
+
+		res, err = c.request(ctx, method, query)
+		if err == nil {
+			return res, nil
+		}
+
+		if attempt == maxRetries || ctx.Err() != nil {
+			break
+		}
+
+		apiErr, ok := AsAPIError(err)
+		if ok && !apiErr.Temporary() {
+			break
+		}
+
+		delay := backoff.Exponential(attempt, baseBackoff, maxBackoff)
+		if ok && apiErr.RetryAfter > 0 {
+			delay = time.Duration(apiErr.RetryAfter) * time.Second
+		}
+
+		log.Printf("[WARN] telegram: %s, retrying in %s", err, delay)
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, e.Wrap("can't do request", err)
+		}
+	}
+
+	return nil, e.Wrap("can't do request", err)
+}
+
+// request performs a single HTTP request to the Telegram Bot API.
+// It constructs the URL based on the method and query parameters, decodes the response envelope
+// and returns the result or an *APIError if the API reported a failure.
+func (c *Client) request(ctx context.Context, method string, query url.Values) (json.RawMessage, error) {
 	u := url.URL{
 		Scheme: "https",
 		Host:   c.host,
 		Path:   path.Join(c.basePath, method),
 	}
 
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
-		return nil, e.Wrap("can't do request", err)
+		return nil, err
 	}
 
 	req.URL.RawQuery = query.Encode()
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, e.Wrap("can't do request", err)
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, e.Wrap("can't do request", err)
+		return nil, err
+	}
+
+	var res Response
+
+	if err := json.Unmarshal(body, &res); err != nil {
+		// Proxies and load balancers may answer with a non-JSON body, e.g. on 502 Bad Gateway.
+		return nil, &APIError{Method: method, Code: resp.StatusCode, Description: http.StatusText(resp.StatusCode)}
 	}
 
-	return body, nil
+	if !res.Ok {
+		apiErr := &APIError{Method: method, Code: res.ErrorCode, Description: res.Description}
+		if apiErr.Code == 0 {
+			apiErr.Code = resp.StatusCode
+		}
+		if res.Parameters != nil {
+			apiErr.RetryAfter = res.Parameters.RetryAfter
+		}
+
+		return nil, apiErr
+	}
+
+	return res.Result, nil
+}
+
+// sleep pauses for the given duration or until the context is done, whichever happens first.
+// It returns the context error if the context is done before the duration elapses.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
 
 // newBasePath constructs the base API path by prepending "bot" to the token.
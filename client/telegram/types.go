@@ -1,35 +1,91 @@
 package telegram
 
-// UpdatesResponse represents the response structure for the getUpdates API method.
-// It contains a boolean Ok to indicate success and a slice of Update objects.
-type UpdatesResponse struct {
-	Ok     bool     `json:"ok"`
-	Result []Update `json:"result"`
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Response represents the common envelope of every Telegram Bot API response.
+// On success Ok is true and Result holds the method specific payload; otherwise
+// ErrorCode and Description explain the failure and Parameters may tell when to retry.
+type Response struct {
+	Ok          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	ErrorCode   int                 `json:"error_code"`
+	Description string              `json:"description"`
+	Parameters  *ResponseParameters `json:"parameters"`
+}
+
+// ResponseParameters contains information about why a request was unsuccessful.
+type ResponseParameters struct {
+	RetryAfter      int `json:"retry_after"`
+	MigrateToChatID int `json:"migrate_to_chat_id"`
 }
 
 // Update represents a single update (message or event) received from the bot.
-// It contains the update ID and a pointer to an IncomingMessage structure, which holds the details of the message.
+// It contains the update ID and either a pointer to an IncomingMessage structure, which holds the details of the message,
+// or a pointer to a CallbackQuery structure, which holds the details of a pressed inline button.
 type Update struct {
-	ID      int              `json:"update_id"`
-	Message *IncomingMessage `json:"message"`
+	ID            int              `json:"update_id"`
+	Message       *IncomingMessage `json:"message"`
+	CallbackQuery *CallbackQuery   `json:"callback_query"`
 }
 
-// IncomingMessage represents the content of an incoming message in an update.
-// It includes the message text, the sender information, and the chat details.
+// IncomingMessage represents the content of an incoming message in an update, or of a message sent by the bot.
+// It includes the message ID, the message text, the sender information, and the chat details.
 type IncomingMessage struct {
+	ID   int    `json:"message_id"`
 	Text string `json:"text"`
 	From From   `json:"from"`
 	Chat Chat   `json:"chat"`
 }
 
-// From represents the sender of the message.
-// It contains the username of the sender.
+// From represents the sender of the message, or the account of the bot.
+// It contains the user ID and the username of the sender.
 type From struct {
+	ID       int    `json:"id"`
 	Username string `json:"username"`
 }
 
 // Chat represents the chat from which the message was sent.
-// It contains the chat ID, which is used to identify the chat.
+// It contains the chat ID, which is used to identify the chat, and the chat type:
+// "private", "group", "supergroup" or "channel".
 type Chat struct {
-	ID int `json:"id"`
+	ID   int    `json:"id"`
+	Type string `json:"type"`
+}
+
+// SendOptions holds the optional parameters of a sent message.
+type SendOptions struct {
+	ParseMode           string                // Parse mode of the text: "HTML", "Markdown" or "MarkdownV2"; plain text if empty.
+	DisableNotification bool                  // Whether to deliver the message silently.
+	ReplyToMessageID    int                   // ID of the message in the same chat to reply to; sent even if that message is gone.
+	MessageThreadID     int                   // ID of the forum topic to send the message to.
+	ReplyMarkup         *InlineKeyboardMarkup // Inline keyboard attached to the message.
+}
+
+// apply adds the options to the query parameters of a request.
+func (o SendOptions) apply(q url.Values) {
+	switch o.ParseMode {
+	case "Markdown", "MarkdownV2", "HTML":
+		q.Add("parse_mode", o.ParseMode)
+	}
+
+	if o.DisableNotification {
+		q.Add("disable_notification", "true")
+	}
+
+	if o.MessageThreadID != 0 {
+		q.Add("message_thread_id", strconv.Itoa(o.MessageThreadID))
+	}
+
+	if o.ReplyToMessageID != 0 {
+		q.Add("reply_parameters", fmt.Sprintf(`{"message_id":%d,"allow_sending_without_reply":true}`, o.ReplyToMessageID))
+	}
+
+	if o.ReplyMarkup != nil {
+		q.Add("reply_markup", o.ReplyMarkup.encode())
+	}
 }
@@ -0,0 +1,194 @@
+// Package config loads the configuration of the bot from a JSON file.
+// The file is either an object with the shared rules and the list of sources,
+// or, in the legacy format, just the list of sources.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"tg_alarm_bot/classifier"
+	"tg_alarm_bot/filter"
+	"tg_alarm_bot/lib/e"
+	"tg_alarm_bot/lib/file"
+	tg_sources "tg_alarm_bot/sources/telegram"
+	"tg_alarm_bot/templates"
+)
+
+// Config represents the configuration of the bot.
+type Config struct {
+	Rules           map[string]filter.Rule `json:"rules,omitempty"`            // Named rules shared by the sources.
+	ExcludeRegexp   []string               `json:"exclude_regexp,omitempty"`   // Regular expressions of messages to drop from every source.
+	ExcludeKeywords []string               `json:"exclude_keywords,omitempty"` // Keywords of messages to drop from every source.
+	NegationCheck   *bool                  `json:"negation_check,omitempty"`   // Whether to drop all-clear and negated messages; true if unset.
+	Classification  classifier.Config      `json:"classification"`             // Labels and severities of the threat types.
+	Sources         []tg_sources.Source    `json:"sources"`                    // Telegram channels to watch.
+	Admins          []int                  `json:"admins,omitempty"`           // IDs of the users allowed to manage the sources with bot commands.
+	engine          *filter.Engine         `json:"-"`                          // Compiled rules.
+}
+
+// Load reads the configuration from the JSON file at path and compiles its rules.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, e.Wrap("can't load config", err)
+	}
+
+	var cfg Config
+
+	// The legacy format is a plain list of sources.
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &cfg.Sources)
+	} else {
+		err = json.Unmarshal(data, &cfg)
+	}
+
+	if err != nil {
+		return nil, e.Wrap("can't parse config", err)
+	}
+
+	if cfg.engine, err = filter.New(cfg.Rules); err != nil {
+		return nil, e.Wrap("can't compile rules", err)
+	}
+
+	for _, s := range cfg.Sources {
+		if !s.LongMessages.Valid() {
+			return nil, e.Wrap("can't load config", fmt.Errorf("source %q: unknown long_messages policy %q", s.Name, s.LongMessages))
+		}
+
+		if !s.MatchOn.Valid() {
+			return nil, e.Wrap("can't load config", fmt.Errorf("source %q: unknown match_on scope %q", s.Name, s.MatchOn))
+		}
+
+		if !s.Edits.Valid() {
+			return nil, e.Wrap("can't load config", fmt.Errorf("source %q: unknown edits policy %q", s.Name, s.Edits))
+		}
+
+		if !s.Retractions.Valid() {
+			return nil, e.Wrap("can't load config", fmt.Errorf("source %q: unknown retractions policy %q", s.Name, s.Retractions))
+		}
+	}
+
+	return &cfg, nil
+}
+
+// Save atomically replaces the JSON file at path with the configuration.
+// The configuration is always written in the current format.
+func (c *Config) Save(path string) error {
+	var buf bytes.Buffer
+
+	// Templates hold HTML, which is kept readable.
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+
+	if err := enc.Encode(c); err != nil {
+		return e.Wrap("can't save config", err)
+	}
+
+	if err := file.WriteAtomic(path, buf.Bytes(), 0644); err != nil {
+		return e.Wrap("can't save config", err)
+	}
+
+	return nil
+}
+
+// Routes returns the destinations of a source with the filters of their rules and their compiled templates.
+// Destinations without a rule get every message of the source, and destinations without a template
+// have none, so they use the template of the source.
+func (c *Config) Routes(s tg_sources.Source) ([]tg_sources.Route, error) {
+	targets := s.Targets()
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("source %q: no destinations", s.Name)
+	}
+
+	routes := make([]tg_sources.Route, 0, len(targets))
+
+	for _, d := range targets {
+		if !d.Retractions.Valid() {
+			return nil, fmt.Errorf("source %q: destination %d: unknown retractions policy %q", s.Name, d.ChatID, d.Retractions)
+		}
+
+		r := tg_sources.Route{Destination: d}
+
+		if d.Template != "" {
+			var err error
+			if r.Template, err = templates.Compile(d.Template); err != nil {
+				return nil, fmt.Errorf("source %q: destination %d: %w", s.Name, d.ChatID, err)
+			}
+		}
+
+		if d.Rule != "" {
+			m, err := c.engine.Matcher(d.Rule)
+			if err != nil {
+				return nil, fmt.Errorf("source %q: destination %d: %w", s.Name, d.ChatID, err)
+			}
+
+			// Exclusions and negations are already checked by the filter of the source.
+			if r.Filter, err = filter.NewFilter(m, false); err != nil {
+				return nil, fmt.Errorf("source %q: destination %d: %w", s.Name, d.ChatID, err)
+			}
+		}
+
+		routes = append(routes, r)
+	}
+
+	return routes, nil
+}
+
+// Template returns the compiled template of a source, or the default one if the source has none.
+// It renders the messages sent to the subscribers and to the destinations without a template of their own.
+func (c *Config) Template(s tg_sources.Source) (*templates.Template, error) {
+	tmpl, err := templates.Compile(s.Template)
+	if err != nil {
+		return nil, fmt.Errorf("source %q: %w", s.Name, err)
+	}
+
+	return tmpl, nil
+}
+
+// Topic returns the matcher of a subscription topic. A topic is the name of a shared rule,
+// or otherwise a region, which is matched as a keyword.
+func (c *Config) Topic(name string) (filter.Matcher, error) {
+	if _, ok := c.Rules[name]; ok {
+		return c.engine.Matcher(name)
+	}
+
+	return filter.Keyword(name)
+}
+
+// Filter returns the filter of a source. Messages are matched by the shared rule the source references,
+// or, if it references none, by its legacy search regular expression. Matched messages are then checked
+// against the global and the source's own exclusions.
+func (c *Config) Filter(s tg_sources.Source) (*filter.Filter, error) {
+	var m filter.Matcher
+	var err error
+
+	if s.Rule != "" {
+		m, err = c.engine.Matcher(s.Rule)
+	} else if m, err = filter.Regexp(s.SearchRegexp); err != nil {
+		err = fmt.Errorf("can't compile search_regexp: %w", err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("source %q: %w", s.Name, err)
+	}
+
+	negation := true
+	if s.NegationCheck != nil {
+		negation = *s.NegationCheck
+	} else if c.NegationCheck != nil {
+		negation = *c.NegationCheck
+	}
+
+	f, err := filter.NewFilter(m, negation,
+		filter.Exclusions{Regexps: c.ExcludeRegexp, Keywords: c.ExcludeKeywords},
+		filter.Exclusions{Regexps: s.ExcludeRegexp, Keywords: s.ExcludeKeywords},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("source %q: %w", s.Name, err)
+	}
+
+	return f, nil
+}
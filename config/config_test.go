@@ -0,0 +1,52 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestShippedRules checks the rules of the shipped configuration against real messages of the sources.
+func TestShippedRules(t *testing.T) {
+	cfg, err := Load("../data/channels.json")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		text    string
+		want    bool
+		sources []string // Sources the expectation applies to; every source if empty.
+	}{
+		{"Шахед на Сумщину", true, nil},
+		{"Сумщина — ракетна небезпека, в укриття", true, nil},
+		{"Шахеди у напрямку Сумського району", true, nil},
+		{"Швидкісна ціль на Сумську область", true, nil},
+		{"Балістика на Суми!", true, nil},
+		{"Курс долара в Сумах знову зріс", false, nil},
+		{"Купила нову сумку, шахеди на фото", false, nil},
+		{"Сума коштів на нову ракету зібрана", false, nil},
+		{"Сума на шахеди", false, nil},
+		{"Відбій тривоги на Сумщині", false, nil},
+		// Only Глухів has been forwarding the mopeds.
+		{"Мопед над Сумами", true, []string{"Глухів (важливо)"}},
+		{"Мопед над Сумами", false, []string{"Sumyregion", "RDS-prostir"}},
+		{"Суми, працює ППО, уважно", true, []string{"Глухів (важливо)", "RDS-prostir"}},
+	}
+
+	for _, s := range cfg.Sources {
+		f, err := cfg.Filter(s)
+		if err != nil {
+			t.Fatalf("Filter(%q) error = %v", s.Name, err)
+		}
+
+		for _, tt := range tests {
+			if len(tt.sources) > 0 && !slices.Contains(tt.sources, s.Name) {
+				continue
+			}
+
+			if got := f.Decide(tt.text); got.Accepted() != tt.want {
+				t.Errorf("%s: Decide(%q) = %s, want accepted %v", s.Name, tt.text, got, tt.want)
+			}
+		}
+	}
+}
@@ -1,5 +1,21 @@
 package consumer
 
+import (
+	"context"
+	"time"
+)
+
+// Consumer defines an interface for long-running consumers of events or messages.
+// Start runs the consumer until the context is done and returns nil after a graceful stop,
+// or an error if the consumer can't continue.
 type Consumer interface {
-	Start() error
+	Start(ctx context.Context) error
+}
+
+// Reporter receives the outcome of every fetch made by a consumer.
+// Success is called after a successful fetch, Failure after a failed one;
+// Failure returns how long the consumer should wait before fetching again.
+type Reporter interface {
+	Success()
+	Failure(err error) time.Duration
 }
@@ -3,7 +3,9 @@
 package event_consumer
 
 import (
+	"context"
 	"log"
+	"tg_alarm_bot/consumer"
 	"tg_alarm_bot/events"
 	"time"
 )
@@ -11,54 +13,68 @@ import (
 // Consumer is responsible for fetching and processing events.
 // It uses a Fetcher to retrieve events and a Processor to handle them.
 // The batchSize determines how many events are fetched at a time.
+// The outcome of every fetch is reported to the reporter.
 type Consumer struct {
 	fetcher   events.Fetcher
 	processor events.Processor
+	reporter  consumer.Reporter
 	batchSize int
 }
 
-// New creates a new Consumer with the provided Fetcher, Processor, and batchSize.
-// The fetcher is used to retrieve events, the processor handles them, and batchSize
-// controls the number of events to fetch at once.
-func New(fetcher events.Fetcher, processor events.Processor, batchSize int) Consumer {
+// New creates a new Consumer with the provided Fetcher, Processor, Reporter and batchSize.
+// The fetcher is used to retrieve events, the processor handles them, the reporter receives
+// the outcome of every fetch, and batchSize controls the number of events to fetch at once.
+func New(fetcher events.Fetcher, processor events.Processor, reporter consumer.Reporter, batchSize int) Consumer {
 	return Consumer{
 		fetcher:   fetcher,
 		processor: processor,
+		reporter:  reporter,
 		batchSize: batchSize,
 	}
 }
 
 // Start begins the continuous loop for fetching and processing events.
 // It fetches events in batches, processes each event, and handles errors.
+// If fetching fails, the consumer waits for the delay returned by the reporter.
 // If no events are fetched, the consumer sleeps for 1 second before trying again.
-func (c *Consumer) Start() error {
-	for {
-		events, err := c.fetcher.Fetch(c.batchSize)
+// When the context is done, the consumer finishes the batch in flight and returns nil.
+func (c *Consumer) Start(ctx context.Context) error {
+	for ctx.Err() == nil {
+		events, err := c.fetcher.Fetch(ctx, c.batchSize)
 		if err != nil {
-			log.Printf("[ERR] consumer: %s", err.Error())
+			if ctx.Err() == nil {
+				log.Printf("[ERR] consumer: %s", err.Error())
+				wait(ctx, c.reporter.Failure(err))
+			}
 			continue
 		}
 
+		c.reporter.Success()
+
 		if len(events) == 0 {
-			time.Sleep(1 * time.Second)
+			wait(ctx, 1*time.Second)
 			continue
 		}
 
-		if err := c.handleEvents(events); err != nil {
+		// The batch is processed with a context that is not cancelled on shutdown,
+		// so the events already taken from Telegram are not lost.
+		if err := c.handleEvents(context.WithoutCancel(ctx), events); err != nil {
 			log.Print(err)
 			continue
 		}
 	}
+
+	return nil
 }
 
 // handleEvents processes each event in the provided slice of events.
 // It logs each new event and attempts to process it. If an error occurs while processing,
 // the error is logged and processing continues with the next event.
-func (c *Consumer) handleEvents(events []events.Event) error {
+func (c *Consumer) handleEvents(ctx context.Context, events []events.Event) error {
 	for _, event := range events {
 		log.Printf("got new event: %q, %d, %v", event.Text, event.Type, event.Meta)
 
-		if err := c.processor.Process(event); err != nil {
+		if err := c.processor.Process(ctx, event); err != nil {
 			log.Printf("can't handle event: %s", err.Error())
 			continue
 		}
@@ -66,3 +82,14 @@ func (c *Consumer) handleEvents(events []events.Event) error {
 
 	return nil
 }
+
+// wait pauses for the given duration or until the context is done.
+func wait(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
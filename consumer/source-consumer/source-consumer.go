@@ -4,55 +4,72 @@
 package source_consumer
 
 import (
+	"context"
 	"log"
+	"tg_alarm_bot/consumer"
+	"tg_alarm_bot/scheduler"
 	"tg_alarm_bot/sources"
-	"time"
 )
 
 // Consumer represents a structure that fetches and processes messages.
-// It relies on an external Fetcher to retrieve the messages and a Processor to handle them.
+// It relies on an external Fetcher to retrieve the messages and a Processor to handle them,
+// reports the outcome of every fetch to a Reporter and polls the source according to a Schedule.
 type Consumer struct {
 	fetcher   sources.Fetcher
 	processor sources.Processor
+	reporter  consumer.Reporter
+	schedule  *scheduler.Schedule
 }
 
-// New creates a new Consumer instance with the provided Fetcher and Processor.
-// It returns a Consumer with both fetcher and processor initialized.
-func New(fetcher sources.Fetcher, processor sources.Processor) Consumer {
+// New creates a new Consumer instance with the provided Fetcher, Processor, Reporter and Schedule.
+// It returns a Consumer with all of them initialized.
+func New(fetcher sources.Fetcher, processor sources.Processor, reporter consumer.Reporter, schedule *scheduler.Schedule) Consumer {
 	return Consumer{
 		fetcher:   fetcher,
 		processor: processor,
+		reporter:  reporter,
+		schedule:  schedule,
 	}
 }
 
-// Start begins an infinite loop that continuously fetches and processes messages.
-// If an error occurs during fetching or processing, it logs the error and continues.
-// If no messages are fetched, it waits for 10 seconds before retrying.
-func (c Consumer) Start() error {
-	for {
-		messages, err := c.fetcher.Fetch()
+// Start begins a loop that fetches and processes messages whenever the schedule says so, until the context is done.
+// If an error occurs during fetching, it logs the error and postpones the next poll by the delay returned by the reporter.
+// If an error occurs during processing, it logs the error and continues.
+// When the context is done, the consumer finishes the batch in flight and returns nil.
+func (c Consumer) Start(ctx context.Context) error {
+	for c.schedule.Wait(ctx) == nil {
+		messages, err := c.fetcher.Fetch(ctx)
 		if err != nil {
-			log.Printf("[ERR] consumer: %s", err.Error())
+			if ctx.Err() == nil {
+				log.Printf("[ERR] consumer: %s", err.Error())
+				c.schedule.Delay(c.reporter.Failure(err))
+			}
 			continue
 		}
 
+		c.reporter.Success()
+		c.schedule.Done(len(messages) > 0)
+
 		if len(messages) == 0 {
-			time.Sleep(10 * time.Second)
 			continue
 		}
 
-		if err := c.handleMessages(messages); err != nil {
+		// The fetched posts are not downloaded again, so their messages are processed
+		// with a context that is not cancelled on shutdown.
+		if err := c.handleMessages(context.WithoutCancel(ctx), messages); err != nil {
 			log.Print(err)
 			continue
 		}
 	}
+
+	return nil
 }
 
 // handleMessages processes each message in the slice using the Processor.
 // If processing a message fails, it logs the error and continues with the next message.
-func (c *Consumer) handleMessages(messages []sources.Message) error {
+func (c *Consumer) handleMessages(ctx context.Context, messages []sources.Message) error {
 	for _, message := range messages {
-		if err := c.processor.Process(message); err != nil {
+		if err := c.processor.Process(ctx, message); err != nil {
 			log.Printf("can't handle message: %s", err.Error())
 			continue
 		}
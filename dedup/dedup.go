@@ -0,0 +1,174 @@
+// Package dedup implements suppression of near-duplicate alerts that several sources post
+// to the same destination channel within a short period of time.
+// Messages are normalized and compared by the Jaccard similarity of their sets of words, so differences
+// in punctuation, emoji or letter case and an extra word or two do not prevent two alerts from being
+// recognized as the same, while alerts that differ in a target or a direction stay apart.
+package dedup
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"tg_alarm_bot/sources"
+	"time"
+	"unicode"
+)
+
+// DefaultThreshold is the default minimum Jaccard similarity of the words of two messages
+// for the messages to be considered duplicates. Two messages that differ in a single word
+// stay apart unless both are at least nine words long.
+const DefaultThreshold = 0.8
+
+// Deduplicator remembers the words of recently delivered messages per destination channel.
+// It is safe for concurrent use by several source consumers.
+type Deduplicator struct {
+	window    time.Duration
+	threshold float64
+	mu        sync.Mutex
+	recent    map[int][]entry
+}
+
+// entry is a delivered message.
+type entry struct {
+	words  map[string]struct{}
+	source string
+	at     time.Time
+}
+
+// New creates a new Deduplicator that treats messages sent to the same destination within window
+// by different sources as duplicates if the Jaccard similarity of their words is at least threshold.
+func New(window time.Duration, threshold float64) *Deduplicator {
+	return &Deduplicator{
+		window:    window,
+		threshold: threshold,
+		recent:    make(map[int][]entry),
+	}
+}
+
+// IsDuplicate reports whether a similar message has already been delivered to dest by another source within the window.
+// Repeated messages of the same source are never duplicates, since the source posted them on purpose.
+// If the message is not a duplicate, it is remembered for subsequent checks.
+// The second return value is the name of the source that delivered the original message.
+func (d *Deduplicator) IsDuplicate(dest int, source string, text string, phrases []string) (bool, string) {
+	words := wordSet(Normalize(text, phrases))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	recent := d.recent[dest][:0]
+
+	for _, en := range d.recent[dest] {
+		if now.Sub(en.at) <= d.window {
+			recent = append(recent, en)
+		}
+	}
+
+	for _, en := range recent {
+		if en.source != source && similarity(en.words, words) >= d.threshold {
+			d.recent[dest] = recent
+			return true, en.source
+		}
+	}
+
+	d.recent[dest] = append(recent, entry{words: words, source: source, at: now})
+
+	return false, ""
+}
+
+// Wrap returns a sources.Processor that removes from the destination chats of the messages of the source
+// the ones a duplicate message was recently delivered to, and passes the messages left with any chats to next.
+func (d *Deduplicator) Wrap(next sources.Processor, source string, phrases []string) sources.Processor {
+	return &processor{
+		d:       d,
+		next:    next,
+		source:  source,
+		phrases: phrases,
+	}
+}
+
+// processor is a sources.Processor that filters out duplicate messages.
+type processor struct {
+	d       *Deduplicator
+	next    sources.Processor
+	source  string
+	phrases []string
+}
+
+// Process passes the message to the wrapped processor unless it is a duplicate in all of its destination chats.
+// Edits and deletions of forwarded messages are always passed, since they update messages that were not duplicates.
+func (p *processor) Process(ctx context.Context, message sources.Message) error {
+	if message.Edit || message.Deleted {
+		return p.next.Process(ctx, message)
+	}
+
+	var chats []int
+
+	for _, chat := range message.Chats {
+		if dup, original := p.d.IsDuplicate(chat, p.source, message.Text, p.phrases); dup {
+			log.Printf("[dedup] drop %s for chat %d: duplicate of a message from %s", message.ID, chat, original)
+			continue
+		}
+
+		chats = append(chats, chat)
+	}
+
+	if len(chats) == 0 {
+		return nil
+	}
+
+	message.Chats = chats
+
+	return p.next.Process(ctx, message)
+}
+
+// Normalize prepares the text for comparison. It removes the given phrases, punctuation, symbols
+// and emoji, lowercases the text and collapses whitespace.
+func Normalize(text string, phrases []string) string {
+	for _, phrase := range phrases {
+		if phrase != "" {
+			text = strings.ReplaceAll(text, phrase, " ")
+		}
+	}
+
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		default:
+			return ' '
+		}
+	}, text)
+
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// wordSet returns the set of words of the normalized text.
+func wordSet(text string) map[string]struct{} {
+	words := make(map[string]struct{})
+
+	for _, word := range strings.Fields(text) {
+		words[word] = struct{}{}
+	}
+
+	return words
+}
+
+// similarity returns the Jaccard similarity of two sets of words:
+// the size of their intersection divided by the size of their union.
+func similarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	common := 0
+
+	for word := range a {
+		if _, ok := b[word]; ok {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(a)+len(b)-common)
+}
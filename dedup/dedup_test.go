@@ -0,0 +1,68 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsDuplicate(t *testing.T) {
+	tests := []struct {
+		name   string
+		first  string
+		second string
+		want   bool
+	}{
+		{"same text", "Балістика на Суми", "Балістика на Суми", true},
+		{"punctuation and emoji", "🚀 Балістика на Суми!", "балістика на суми", true},
+		{"extra word", "Увага! Шахед курсом на Суми", "Шахед курсом на Суми", true},
+		{"different target", "Балістика на Суми", "Балістика на Конотоп", false},
+		{"different target after warning", "Увага! Швидкісна ціль на Суми", "Увага! Швидкісна ціль на Шостку", false},
+		{"different direction", "Шахед курсом на Суми з півночі", "Шахед курсом на Суми з півдня", false},
+		{"unrelated", "Відбій тривоги", "Балістика на Суми", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(time.Minute, DefaultThreshold)
+
+			if dup, _ := d.IsDuplicate(1, "a", tt.first, nil); dup {
+				t.Fatalf("first message reported as duplicate")
+			}
+
+			if dup, _ := d.IsDuplicate(1, "b", tt.second, nil); dup != tt.want {
+				t.Errorf("IsDuplicate(%q after %q) = %v, want %v", tt.second, tt.first, dup, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDuplicateSameSource(t *testing.T) {
+	d := New(time.Minute, DefaultThreshold)
+
+	d.IsDuplicate(1, "a", "Балістика на Суми", nil)
+
+	if dup, _ := d.IsDuplicate(1, "a", "Балістика на Суми", nil); dup {
+		t.Errorf("repeated message of the same source reported as duplicate")
+	}
+
+	if dup, original := d.IsDuplicate(1, "b", "Балістика на Суми", nil); !dup || original != "a" {
+		t.Errorf("IsDuplicate() = %v, %q, want true, %q", dup, original, "a")
+	}
+}
+
+func TestIsDuplicateOtherDestination(t *testing.T) {
+	d := New(time.Minute, DefaultThreshold)
+
+	d.IsDuplicate(1, "a", "Балістика на Суми", nil)
+
+	if dup, _ := d.IsDuplicate(2, "b", "Балістика на Суми", nil); dup {
+		t.Errorf("message to another destination reported as duplicate")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got := Normalize("⚡️ Увага!  Шахед — на Суми. Підписатися", []string{"Підписатися"})
+	if want := "увага шахед на суми"; got != want {
+		t.Errorf("Normalize() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"tg_alarm_bot/admin"
+)
+
+// addSource starts watching a channel. The arguments are the name of the source, the channel,
+// the ID of the chat to forward the alerts to and the shared rule that selects them.
+func (p *Processor) addSource(ctx context.Context, req Request) (Reply, error) {
+	usage := Reply{Text: "Usage: /addsource &lt;name&gt; &lt;channel&gt; &lt;chat id&gt; &lt;rule&gt;"}
+
+	if p.deps.Admin == nil || len(req.Args) != 4 {
+		return usage, nil
+	}
+
+	chatID, err := strconv.Atoi(req.Args[2])
+	if err != nil {
+		return usage, nil
+	}
+
+	if err := p.deps.Admin.AddSource(req.Args[0], req.Args[1], chatID, req.Args[3]); err != nil {
+		return adminError(err), nil
+	}
+
+	return Reply{Text: fmt.Sprintf("Source <b>%s</b> added.", html.EscapeString(req.Args[0]))}, nil
+}
+
+// removeSource stops watching the source named by the arguments.
+func (p *Processor) removeSource(ctx context.Context, req Request) (Reply, error) {
+	return p.sourceAction(req, "/rmsource", "removed", p.deps.Admin.RemoveSource)
+}
+
+// pause stops polling the source named by the arguments.
+func (p *Processor) pause(ctx context.Context, req Request) (Reply, error) {
+	return p.sourceAction(req, "/pause", "paused", p.deps.Admin.Pause)
+}
+
+// resume polls the paused source named by the arguments again.
+func (p *Processor) resume(ctx context.Context, req Request) (Reply, error) {
+	return p.sourceAction(req, "/resume", "resumed", p.deps.Admin.Resume)
+}
+
+// setRegexp makes the source select alerts by a regular expression. The arguments are the name of the source
+// and the expression; the words of the expression are joined by single spaces.
+func (p *Processor) setRegexp(ctx context.Context, req Request) (Reply, error) {
+	name, rest, ok := p.splitSource(req.Args)
+	if !ok || len(rest) == 0 {
+		return Reply{Text: "Usage: /setregex &lt;name&gt; &lt;regexp&gt;"}, nil
+	}
+
+	expr := strings.Join(rest, " ")
+
+	if err := p.deps.Admin.SetRegexp(name, expr); err != nil {
+		return adminError(err), nil
+	}
+
+	return Reply{Text: fmt.Sprintf("Source <b>%s</b> now selects alerts by <code>%s</code>.", html.EscapeString(name), html.EscapeString(expr))}, nil
+}
+
+// testRegexp reports whether the source would forward a text. The arguments are the name of the source and the text.
+func (p *Processor) testRegexp(ctx context.Context, req Request) (Reply, error) {
+	name, rest, ok := p.splitSource(req.Args)
+	if !ok || len(rest) == 0 {
+		return Reply{Text: "Usage: /testregex &lt;name&gt; &lt;text&gt;"}, nil
+	}
+
+	decision, err := p.deps.Admin.TestRegexp(name, strings.Join(rest, " "))
+	if err != nil {
+		return adminError(err), nil
+	}
+
+	verdict := "✅ forwarded"
+	if !decision.Accepted() {
+		verdict = "❌ not forwarded"
+	}
+
+	return Reply{Text: fmt.Sprintf("%s\n<code>%s</code>", verdict, html.EscapeString(decision.String()))}, nil
+}
+
+// sourceAction applies the action to the source named by all the arguments and reports the outcome.
+func (p *Processor) sourceAction(req Request, command, done string, action func(name string) error) (Reply, error) {
+	name, rest, ok := p.splitSource(req.Args)
+	if !ok || len(rest) > 0 {
+		return Reply{Text: fmt.Sprintf("Usage: %s &lt;name&gt;\nSend /sources for the list of sources.", command)}, nil
+	}
+
+	if err := action(name); err != nil {
+		return adminError(err), nil
+	}
+
+	return Reply{Text: fmt.Sprintf("Source <b>%s</b> %s.", html.EscapeString(name), done)}, nil
+}
+
+// splitSource splits the arguments into the name of a known source and the rest.
+func (p *Processor) splitSource(args []string) (string, []string, bool) {
+	if p.deps.Admin == nil {
+		return "", nil, false
+	}
+
+	return p.deps.Admin.Split(args)
+}
+
+// adminError reports the failure of an admin command to the admin.
+func adminError(err error) Reply {
+	if errors.Is(err, admin.ErrUnknownSource) || errors.Is(err, admin.ErrSourceExists) {
+		return Reply{Text: html.EscapeString(err.Error()) + ". Send /sources for the list of sources."}
+	}
+
+	return Reply{Text: "Failed: " + html.EscapeString(err.Error())}
+}
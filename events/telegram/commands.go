@@ -0,0 +1,319 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"tg_alarm_bot/admin"
+	"tg_alarm_bot/client/telegram"
+	"tg_alarm_bot/journal"
+	"tg_alarm_bot/lib/runes"
+	"tg_alarm_bot/subscriptions"
+	"tg_alarm_bot/supervisor"
+	"time"
+)
+
+const (
+	// defaultLast is the number of alerts listed by /last without an argument.
+	defaultLast = 5
+	// maxLast is the maximum number of alerts listed by /last.
+	maxLast = 20
+	// maxAlertText is the maximum length in runes of an alert listed by /last.
+	maxAlertText = 200
+	// timeLayout is the layout of the times in the replies.
+	timeLayout = "02.01 15:04"
+)
+
+// SourceInfo describes a watched channel for the /sources command.
+type SourceInfo struct {
+	Name   string // Name of the source.
+	URL    string // URL of the channel.
+	Paused bool   // Whether the channel is paused.
+}
+
+// Deps holds the parts of the bot the built-in commands report on.
+type Deps struct {
+	Supervisor    *supervisor.Supervisor       // Supervisor of the consumers, for /status.
+	Journal       *journal.Journal             // Journal of forwarded alerts, for /status and /last.
+	Sources       func() []SourceInfo          // Lists the watched channels, for /sources.
+	Admin         *admin.Manager               // Manager of the sources, for the admin commands.
+	Subscriptions *subscriptions.Subscriptions // Subscriptions of users, for /subscribe and /unsubscribe.
+	Topics        func() []string              // Lists the topics offered as buttons in the subscription menu.
+	BotUsername   string                       // Username of the bot, to ignore the commands addressed to other bots.
+}
+
+// stateIcons marks the states of the consumers in /status.
+var stateIcons = map[supervisor.State]string{
+	supervisor.Running:    "🟢",
+	supervisor.Degraded:   "🟡",
+	supervisor.Down:       "🔴",
+	supervisor.Restarting: "🔄",
+	supervisor.Stopped:    "⚪",
+	supervisor.Paused:     "⏸",
+}
+
+// registerDefaults registers the built-in commands in the router of the processor.
+func (p *Processor) registerDefaults() {
+	p.router.Handle("start", "introduction to the bot", p.start)
+	p.router.Handle("help", "list of commands", p.help)
+	p.router.Handle("status", "state of the sources and time of their last alerts", p.status)
+	p.router.Handle("last", "recent alerts, e.g. /last 10", p.last)
+	p.router.Handle("sources", "watched channels", p.sources)
+	p.router.Handle("ping", "check that the bot is alive", p.ping)
+	p.router.Handle("subscribe", "receive alerts of a region or rule here, e.g. /subscribe суми; the menu without an argument", p.subscribe)
+	p.router.Handle("unsubscribe", "stop receiving alerts of a region or rule, or of all without an argument", p.unsubscribe)
+
+	p.router.HandleAdmin("addsource", "watch a channel: /addsource <name> <channel> <chat id> <rule>", p.addSource)
+	p.router.HandleAdmin("rmsource", "stop watching a channel: /rmsource <name>", p.removeSource)
+	p.router.HandleAdmin("pause", "stop polling a channel for a while: /pause <name>", p.pause)
+	p.router.HandleAdmin("resume", "poll a paused channel again: /resume <name>", p.resume)
+	p.router.HandleAdmin("setregex", "select the alerts of a channel by a regexp: /setregex <name> <regexp>", p.setRegexp)
+	p.router.HandleAdmin("testregex", "check whether a channel would forward a text: /testregex <name> <text>", p.testRegexp)
+}
+
+// start greets the user and lists the commands.
+func (p *Processor) start(ctx context.Context, req Request) (Reply, error) {
+	help, err := p.help(ctx, req)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	help.Text = "This bot forwards air raid alerts from public Telegram channels.\n\n" + help.Text
+
+	return help, nil
+}
+
+// help lists the registered commands.
+func (p *Processor) help(ctx context.Context, req Request) (Reply, error) {
+	var b strings.Builder
+
+	b.WriteString("<b>Commands</b>\n")
+
+	for _, c := range p.router.list(req.Admin) {
+		fmt.Fprintf(&b, "/%s — %s\n", c.name, html.EscapeString(c.description))
+	}
+
+	return Reply{Text: b.String()}, nil
+}
+
+// status reports the state of every consumer and the time of the last alert of every source.
+func (p *Processor) status(ctx context.Context, req Request) (Reply, error) {
+	if p.deps.Supervisor == nil {
+		return Reply{Text: "Status is not available."}, nil
+	}
+
+	var b strings.Builder
+
+	b.WriteString("<b>Status</b>\n")
+
+	for _, st := range p.deps.Supervisor.Statuses() {
+		fmt.Fprintf(&b, "%s %s — %s", stateIcons[st.State], html.EscapeString(st.Name), st.State)
+
+		if p.deps.Journal != nil {
+			if last := p.deps.Journal.LastAlert(st.Name); !last.IsZero() {
+				fmt.Fprintf(&b, ", last alert %s", last.Local().Format(timeLayout))
+			}
+		}
+
+		if st.State != supervisor.Running && st.LastError != "" {
+			fmt.Fprintf(&b, "\n    <i>%s</i>", html.EscapeString(st.LastError))
+		}
+
+		b.WriteString("\n")
+	}
+
+	return Reply{Text: b.String()}, nil
+}
+
+// last lists the recent alerts. The optional argument is the number of alerts.
+func (p *Processor) last(ctx context.Context, req Request) (Reply, error) {
+	if p.deps.Journal == nil {
+		return Reply{Text: "Recent alerts are not available."}, nil
+	}
+
+	n := defaultLast
+	if len(req.Args) > 0 {
+		v, err := strconv.Atoi(req.Args[0])
+		if err != nil || v < 1 {
+			return Reply{Text: "Usage: /last [number of alerts]"}, nil
+		}
+
+		n = min(v, maxLast)
+	}
+
+	entries := p.deps.Journal.Recent(n)
+	if len(entries) == 0 {
+		return Reply{Text: "No alerts since the bot started."}, nil
+	}
+
+	var b strings.Builder
+
+	for _, en := range entries {
+		text := runes.Truncate(en.Text, maxAlertText)
+
+		fmt.Fprintf(&b, "<b>%s</b> %s %s\n%s\n\n",
+			en.Time.Local().Format(timeLayout), html.EscapeString(en.Source), en.Label, html.EscapeString(text))
+	}
+
+	return Reply{Text: b.String()}, nil
+}
+
+// sources lists the watched channels.
+func (p *Processor) sources(ctx context.Context, req Request) (Reply, error) {
+	var list []SourceInfo
+	if p.deps.Sources != nil {
+		list = p.deps.Sources()
+	}
+
+	if len(list) == 0 {
+		return Reply{Text: "No channels are watched."}, nil
+	}
+
+	var b strings.Builder
+
+	b.WriteString("<b>Sources</b>\n")
+
+	for _, s := range list {
+		fmt.Fprintf(&b, "• <a href=\"%s\">%s</a>", html.EscapeString(s.URL), html.EscapeString(s.Name))
+
+		if s.Paused {
+			b.WriteString(" (paused)")
+		}
+
+		b.WriteString("\n")
+	}
+
+	return Reply{Text: b.String()}, nil
+}
+
+// ping answers with the time the bot has been running.
+func (p *Processor) ping(ctx context.Context, req Request) (Reply, error) {
+	return Reply{Text: fmt.Sprintf("pong, up for %s", time.Since(p.started).Round(time.Second))}, nil
+}
+
+// subscribe subscribes the private chat to the region or rule given as the argument.
+// Without an argument, it shows the subscription menu of the chat.
+func (p *Processor) subscribe(ctx context.Context, req Request) (Reply, error) {
+	if p.deps.Subscriptions == nil {
+		return Reply{Text: "Subscriptions are not available."}, nil
+	}
+
+	if req.ChatType != "private" {
+		return Reply{Text: "Subscriptions are available only in the private chat with the bot."}, nil
+	}
+
+	if len(req.Args) == 0 {
+		return p.menu(req.ChatID, "")
+	}
+
+	topic, err := p.deps.Subscriptions.Subscribe(req.ChatID, strings.Join(req.Args, " "))
+	if errors.Is(err, subscriptions.ErrInvalidTopic) {
+		return p.menu(req.ChatID, "Unknown region or rule.")
+	}
+	if err != nil {
+		return Reply{}, err
+	}
+
+	return p.menu(req.ChatID, fmt.Sprintf("You are subscribed to <b>%s</b>.", html.EscapeString(topic)))
+}
+
+// unsubscribe unsubscribes the chat from the region or rule given as the argument, or from all of them.
+// In the private chat, the reply is the updated subscription menu.
+func (p *Processor) unsubscribe(ctx context.Context, req Request) (Reply, error) {
+	if p.deps.Subscriptions == nil {
+		return Reply{Text: "Subscriptions are not available."}, nil
+	}
+
+	topic := strings.Join(req.Args, " ")
+
+	ok, err := p.deps.Subscriptions.Unsubscribe(req.ChatID, topic)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	var status string
+
+	switch {
+	case !ok && topic == "":
+		status = "You have no subscriptions."
+	case !ok:
+		status = fmt.Sprintf("You are not subscribed to <b>%s</b>.", html.EscapeString(subscriptions.Normalize(topic)))
+	case topic == "":
+		status = "You are unsubscribed from all alerts."
+	default:
+		status = fmt.Sprintf("You are unsubscribed from <b>%s</b>.", html.EscapeString(subscriptions.Normalize(topic)))
+	}
+
+	if req.ChatType != "private" {
+		return Reply{Text: status}, nil
+	}
+
+	return p.menu(req.ChatID, status)
+}
+
+// menu returns the subscription menu of the chat, preceded by the status line if it is not empty.
+// The menu lists the subscriptions of the chat with buttons to cancel them, and buttons to subscribe
+// to the suggested topics the chat is not subscribed to yet.
+func (p *Processor) menu(chatID int, status string) (Reply, error) {
+	topics, err := p.deps.Subscriptions.List(chatID)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	var b strings.Builder
+
+	if status != "" {
+		b.WriteString(status + "\n\n")
+	}
+
+	if len(topics) == 0 {
+		b.WriteString("You have no subscriptions.")
+	} else {
+		b.WriteString("You are subscribed to: " + html.EscapeString(strings.Join(topics, ", ")) + ".")
+	}
+
+	b.WriteString("\nSubscribe to any region with /subscribe &lt;region&gt;, or press a button.")
+
+	var rows [][]telegram.InlineKeyboardButton
+
+	for _, topic := range topics {
+		if btn, ok := button("❌ "+topic, "/unsubscribe "+topic); ok {
+			rows = append(rows, []telegram.InlineKeyboardButton{btn})
+		}
+	}
+
+	var offered []string
+	if p.deps.Topics != nil {
+		offered = p.deps.Topics()
+	}
+
+	for _, topic := range offered {
+		if slices.Contains(topics, topic) {
+			continue
+		}
+
+		if btn, ok := button("➕ "+topic, "/subscribe "+topic); ok {
+			rows = append(rows, []telegram.InlineKeyboardButton{btn})
+		}
+	}
+
+	if len(rows) == 0 {
+		return Reply{Text: b.String()}, nil
+	}
+
+	return Reply{Text: b.String(), Keyboard: &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}}, nil
+}
+
+// button returns an inline button sending the command when pressed.
+// The returned flag is false if the command doesn't fit in the callback data.
+func button(text, command string) (telegram.InlineKeyboardButton, bool) {
+	if len(command) > telegram.MaxCallbackData {
+		return telegram.InlineKeyboardButton{}, false
+	}
+
+	return telegram.InlineKeyboardButton{Text: text, CallbackData: command}, true
+}
@@ -0,0 +1,118 @@
+package telegram
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"tg_alarm_bot/client/telegram"
+)
+
+// Request is a command sent to the bot.
+type Request struct {
+	Command  string   // Name of the command without the slash and the bot username, e.g. "last".
+	Args     []string // Arguments following the command, split by whitespace.
+	ChatID   int      // ID of the chat the command was sent in.
+	ChatType string   // Type of the chat: "private", "group", "supergroup" or "channel".
+	UserID   int      // ID of the sender.
+	Username string   // Username of the sender.
+	Admin    bool     // Whether the sender may use the admin commands.
+}
+
+// Reply is the answer to a command.
+type Reply struct {
+	Text     string                         // Text in the HTML subset supported by the Telegram Bot API.
+	Keyboard *telegram.InlineKeyboardMarkup // Inline keyboard attached to the reply, if any.
+}
+
+// Handler handles a command and returns the reply.
+type Handler func(ctx context.Context, req Request) (Reply, error)
+
+// command is a registered command.
+type command struct {
+	name        string
+	description string
+	handler     Handler
+	admin       bool
+}
+
+// Router dispatches the commands sent to the bot to their handlers.
+type Router struct {
+	commands map[string]command
+	username string
+}
+
+// NewRouter creates an empty Router of the bot with the given username.
+// Commands addressed to other bots, like "/status@other_bot", are ignored; if username is empty, none are.
+func NewRouter(username string) *Router {
+	return &Router{commands: make(map[string]command), username: username}
+}
+
+// Handle registers the handler of the command with the given name and description.
+// A handler registered for the same name replaces the previous one.
+func (r *Router) Handle(name, description string, h Handler) {
+	r.commands[name] = command{name: name, description: description, handler: h}
+}
+
+// HandleAdmin registers the handler of the admin command with the given name and description.
+// Admin commands are answered only for requests from admins.
+func (r *Router) HandleAdmin(name, description string, h Handler) {
+	r.commands[name] = command{name: name, description: description, handler: h, admin: true}
+}
+
+// Route parses the text of a message, or the data of a pressed inline button, and calls the handler of the command.
+// The returned flag is false if the text is not a command, the command is addressed to another bot or is unknown.
+func (r *Router) Route(ctx context.Context, req Request, text string) (Reply, bool, error) {
+	name, bot, args, ok := parseCommand(text)
+	if !ok {
+		return Reply{}, false, nil
+	}
+
+	if bot != "" && r.username != "" && !strings.EqualFold(bot, r.username) {
+		return Reply{}, false, nil
+	}
+
+	cmd, ok := r.commands[name]
+	if !ok {
+		return Reply{}, false, nil
+	}
+
+	if cmd.admin && !req.Admin {
+		return Reply{Text: "This command is available only to admins."}, true, nil
+	}
+
+	req.Command, req.Args = name, args
+
+	reply, err := cmd.handler(ctx, req)
+
+	return reply, true, err
+}
+
+// list returns the registered commands sorted by name, without the admin ones unless admin is set.
+func (r *Router) list(admin bool) []command {
+	res := make([]command, 0, len(r.commands))
+	for _, c := range r.commands {
+		if !c.admin || admin {
+			res = append(res, c)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+
+	return res
+}
+
+// parseCommand splits a command message like "/last@alarm_bot 5" into the command name, the username
+// of the bot it is addressed to, if any, and its arguments. The returned flag is false if the text is not a command.
+func parseCommand(text string) (string, string, []string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", "", nil, false
+	}
+
+	name, bot, _ := strings.Cut(fields[0][1:], "@")
+	if name == "" {
+		return "", "", nil, false
+	}
+
+	return strings.ToLower(name), bot, fields[1:], true
+}
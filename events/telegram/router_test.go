@@ -0,0 +1,53 @@
+package telegram
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRouterRoute(t *testing.T) {
+	r := NewRouter("alarm_bot")
+
+	var got Request
+	r.Handle("last", "", func(ctx context.Context, req Request) (Reply, error) {
+		got = req
+		return Reply{Text: "ok"}, nil
+	})
+	r.HandleAdmin("pause", "", func(ctx context.Context, req Request) (Reply, error) {
+		return Reply{Text: "paused"}, nil
+	})
+
+	tests := []struct {
+		text  string
+		admin bool
+		want  bool
+		reply string
+		args  []string
+	}{
+		{"/last 5", false, true, "ok", []string{"5"}},
+		{"/LAST@Alarm_Bot 5", false, true, "ok", []string{"5"}},
+		{"/last@other_bot 5", false, false, "", nil},
+		{"/unknown", false, false, "", nil},
+		{"last", false, false, "", nil},
+		{"/pause Sumy", false, true, "This command is available only to admins.", nil},
+		{"/pause Sumy", true, true, "paused", nil},
+	}
+
+	for _, tt := range tests {
+		got = Request{}
+
+		reply, ok, err := r.Route(context.Background(), Request{Admin: tt.admin}, tt.text)
+		if err != nil {
+			t.Fatalf("Route(%q) error = %v", tt.text, err)
+		}
+
+		if ok != tt.want || reply.Text != tt.reply {
+			t.Errorf("Route(%q) = %q, %v, want %q, %v", tt.text, reply.Text, ok, tt.reply, tt.want)
+		}
+
+		if tt.args != nil && !reflect.DeepEqual(got.Args, tt.args) {
+			t.Errorf("Route(%q) args = %q, want %q", tt.text, got.Args, tt.args)
+		}
+	}
+}
@@ -1,25 +1,39 @@
 // Package telegram provides a processor for handling events and interacting with the Telegram Bot API.
-// It includes functions for fetching and processing events and converting Telegram updates into internal event types.
+// It includes functions for fetching and processing events, converting Telegram updates into internal event types,
+// and a router of the commands the bot answers to.
 package telegram
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"tg_alarm_bot/client/telegram"
 	"tg_alarm_bot/events"
 	"tg_alarm_bot/lib/e"
+	"time"
 )
 
 // Processor handles fetching and processing of Telegram updates.
-// It maintains the client for Telegram communication and the current update offset.
+// It maintains the client for Telegram communication, the current update offset
+// and the router of the commands the bot answers to.
 type Processor struct {
-	tg     *telegram.Client
-	offset int
+	tg      *telegram.Client
+	offset  int
+	router  *Router
+	deps    Deps
+	started time.Time
 }
 
-// Meta contains metadata for a message, including the chat ID and the username of the sender.
+// Meta contains metadata for a message or a pressed inline button, including the chat ID and type,
+// the ID of the message or of the message with the button, the ID and username of the sender
+// and, for a pressed button, the ID of the callback query to answer.
 type Meta struct {
-	ChatID   int
-	Username string
+	ChatID     int
+	ChatType   string
+	MessageID  int
+	UserID     int
+	Username   string
+	CallbackID string
 }
 
 var (
@@ -30,16 +44,29 @@ var (
 )
 
 // New creates a new Processor with the provided Telegram client.
-func New(client *telegram.Client) *Processor {
-	return &Processor{
-		tg: client,
+// The built-in commands report on the parts of the bot given in deps.
+func New(client *telegram.Client, deps Deps) *Processor {
+	p := &Processor{
+		tg:      client,
+		router:  NewRouter(deps.BotUsername),
+		deps:    deps,
+		started: time.Now(),
 	}
+
+	p.registerDefaults()
+
+	return p
+}
+
+// Router returns the router of the commands, so more commands can be registered.
+func (p *Processor) Router() *Router {
+	return p.router
 }
 
 // Fetch retrieves a list of events by fetching updates from the Telegram Bot API.
 // It returns a slice of events and updates the offset to process subsequent events.
-func (p *Processor) Fetch(limit int) ([]events.Event, error) {
-	updates, err := p.tg.Updates(p.offset, limit)
+func (p *Processor) Fetch(ctx context.Context, limit int) ([]events.Event, error) {
+	updates, err := p.tg.Updates(ctx, p.offset, limit)
 	if err != nil {
 		return nil, e.Wrap("can't get events", err)
 	}
@@ -60,25 +87,111 @@ func (p *Processor) Fetch(limit int) ([]events.Event, error) {
 }
 
 // Process processes a single event by checking its type and handling it accordingly.
-// Currently, it only supports processing message events.
-func (p *Processor) Process(event events.Event) error {
+// It supports message and callback events.
+func (p *Processor) Process(ctx context.Context, event events.Event) error {
 	switch event.Type {
 	case events.Message:
-		return p.processMessage(event)
+		return p.processMessage(ctx, event)
+	case events.Callback:
+		return p.processCallback(ctx, event)
 	default:
 		return e.Wrap("can't process event", ErrUnknownEventType)
 	}
 }
 
 // processMessage handles the processing of message events.
-// It retrieves metadata from the event and sends a response message using the Telegram client.
-func (p *Processor) processMessage(event events.Event) error {
+// Commands are passed to their handlers and the replies are sent back to the chat; in groups the reply
+// quotes the command, so it is clear whom it answers. Other private messages get a hint about /help,
+// while other group messages are ignored.
+func (p *Processor) processMessage(ctx context.Context, event events.Event) error {
 	m, err := meta(event)
 	if err != nil {
 		return e.Wrap("can't process message", err)
 	}
 
-	return p.tg.SendMessage(m.ChatID, "This bot does not interact directly.", "")
+	reply, ok, err := p.router.Route(ctx, p.request(m), event.Text)
+	if err != nil {
+		return e.Wrap("can't process command", err)
+	}
+
+	switch {
+	case ok:
+	case m.ChatType != "private":
+		return nil
+	case strings.HasPrefix(event.Text, "/"):
+		reply = Reply{Text: "Unknown command. Send /help for the list of commands."}
+	default:
+		reply = Reply{Text: "This bot does not interact directly. Send /help for the list of commands."}
+	}
+
+	opts := telegram.SendOptions{ParseMode: "HTML", ReplyMarkup: reply.Keyboard}
+
+	if m.ChatType != "private" {
+		opts.ReplyToMessageID = m.MessageID
+	}
+
+	if _, err := p.tg.SendMessage(ctx, m.ChatID, reply.Text, opts); err != nil {
+		return e.Wrap("can't process message", err)
+	}
+
+	return nil
+}
+
+// processCallback handles the processing of callback events.
+// The data of the pressed button is routed as a command, and the message with the button is replaced
+// with the reply, so menus are updated in place. The press is always answered, so the button stops loading;
+// unknown buttons, e.g. of menus from older versions of the bot, are answered with a notice.
+func (p *Processor) processCallback(ctx context.Context, event events.Event) error {
+	m, err := meta(event)
+	if err != nil {
+		return e.Wrap("can't process callback", err)
+	}
+
+	req := p.request(m)
+
+	var reply Reply
+	var ok bool
+
+	// Buttons of messages too old to be delivered with the callback have no chat to answer in.
+	if m.ChatID != 0 {
+		if reply, ok, err = p.router.Route(ctx, req, event.Text); err != nil {
+			return e.Wrap("can't process callback", err)
+		}
+	}
+
+	notice := ""
+	if !ok {
+		notice = "This button is no longer available."
+	}
+
+	if err := p.tg.AnswerCallbackQuery(ctx, m.CallbackID, notice, false); err != nil {
+		return e.Wrap("can't process callback", err)
+	}
+
+	if !ok {
+		return nil
+	}
+
+	err = p.tg.EditMessageText(ctx, m.ChatID, m.MessageID, reply.Text, telegram.SendOptions{ParseMode: "HTML", ReplyMarkup: reply.Keyboard})
+	if apiErr, isAPI := telegram.AsAPIError(err); isAPI && strings.Contains(apiErr.Description, "message is not modified") {
+		return nil
+	}
+	if err != nil {
+		return e.Wrap("can't process callback", err)
+	}
+
+	return nil
+}
+
+// request makes the request of a command sent with the given metadata.
+func (p *Processor) request(m Meta) Request {
+	return Request{
+		ChatID:   m.ChatID,
+		ChatType: m.ChatType,
+		UserID:   m.UserID,
+		Username: m.Username,
+		Admin:    p.deps.Admin != nil && p.deps.Admin.IsAdmin(m.UserID),
+	}
 }
 
 // meta extracts metadata from the event's Meta field and casts it to the Meta type.
@@ -102,32 +215,55 @@ func utoe(u telegram.Update) events.Event {
 		Text: fetchText(u),
 	}
 
-	if uType == events.Message {
+	switch uType {
+	case events.Message:
 		res.Meta = Meta{
-			ChatID:   u.Message.Chat.ID,
-			Username: u.Message.From.Username,
+			ChatID:    u.Message.Chat.ID,
+			ChatType:  u.Message.Chat.Type,
+			MessageID: u.Message.ID,
+			UserID:    u.Message.From.ID,
+			Username:  u.Message.From.Username,
+		}
+	case events.Callback:
+		m := Meta{
+			UserID:     u.CallbackQuery.From.ID,
+			Username:   u.CallbackQuery.From.Username,
+			CallbackID: u.CallbackQuery.ID,
+		}
+
+		if msg := u.CallbackQuery.Message; msg != nil {
+			m.ChatID, m.ChatType, m.MessageID = msg.Chat.ID, msg.Chat.Type, msg.ID
 		}
+
+		res.Meta = m
 	}
 
 	return res
 }
 
 // fetchType determines the event type based on the content of the Telegram update.
-// If the update contains a message, it returns events.Message; otherwise, it returns events.Unknown.
+// If the update contains a message, it returns events.Message; if it contains a callback query,
+// it returns events.Callback; otherwise, it returns events.Unknown.
 func fetchType(u telegram.Update) events.Type {
-	if u.Message == nil {
+	switch {
+	case u.Message != nil:
+		return events.Message
+	case u.CallbackQuery != nil:
+		return events.Callback
+	default:
 		return events.Unknown
 	}
-
-	return events.Message
 }
 
-// fetchText retrieves the text content from the Telegram update.
-// If the update does not contain a message, it returns an empty string.
+// fetchText retrieves the text content from the Telegram update: the text of a message
+// or the data of a pressed inline button. Otherwise, it returns an empty string.
 func fetchText(u telegram.Update) string {
-	if u.Message == nil {
+	switch {
+	case u.Message != nil:
+		return u.Message.Text
+	case u.CallbackQuery != nil:
+		return u.CallbackQuery.Data
+	default:
 		return ""
 	}
-
-	return u.Message.Text
 }
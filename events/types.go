@@ -2,16 +2,18 @@
 // as well as the structure of an event and its types.
 package events
 
+import "context"
+
 // Fetcher defines an interface for fetching events.
 // The Fetch method accepts a limit and returns a slice of Event objects and an error if any.
 type Fetcher interface {
-	Fetch(limit int) ([]Event, error)
+	Fetch(ctx context.Context, limit int) ([]Event, error)
 }
 
 // Processor defines an interface for processing events.
 // The Process method accepts an Event and returns an error if the processing fails.
 type Processor interface {
-	Process(e Event) error
+	Process(ctx context.Context, e Event) error
 }
 
 // Type represents the type of an event. It is an enumerated integer type.
@@ -22,6 +24,8 @@ const (
 	Unknown Type = iota
 	// Message represents an event of type Message, typically used for text-based messages.
 	Message
+	// Callback represents the press of an inline button; the text of the event is the data of the button.
+	Callback
 )
 
 // Event represents a generic event with a type, text content, and additional metadata.
@@ -0,0 +1,165 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"tg_alarm_bot/normalize"
+)
+
+var (
+	// allClearPhrases announce that a threat is over, wherever they occur in a message.
+	allClearPhrases = []string{
+		"відбій", "загроза минула", "загрози немає", "загрози нема", "все чисто", "усе чисто",
+		"отбой", "угроза миновала", "угрозы нет",
+	}
+	// negationWords cancel the keywords they directly precede, e.g. "немає шахедів", or the keywords of the clause
+	// they end, e.g. "шахедів над Сумами більше немає".
+	negationWords = []string{
+		"немає", "нема", "чисто", "зникли", "зник", "нет", "пропали",
+	}
+	// clauseBreaks separate the clauses of a text; a negation applies only within its clause.
+	clauseBreaks = regexp.MustCompile(`[.,;:!?…()\n]|\s[-–—]+\s`)
+)
+
+// Exclusions configures the messages that are dropped even though they match a rule.
+type Exclusions struct {
+	Regexps  []string // Regular expressions of messages to drop, matched case-insensitively.
+	Keywords []string // Keywords of messages to drop, matched as the keywords of rules.
+}
+
+// Decision is the outcome of filtering a text, kept for debugging.
+type Decision struct {
+	Result
+	Excluded bool   // Whether the matched text was excluded.
+	Reason   string // Why the text was excluded.
+}
+
+// Accepted reports whether the text matched and was not excluded.
+func (d Decision) Accepted() bool {
+	return d.Matched && !d.Excluded
+}
+
+// String describes the decision in a human-readable form.
+func (d Decision) String() string {
+	switch {
+	case !d.Matched:
+		return "no match"
+	case d.Excluded:
+		return fmt.Sprintf("matched %q (score %g), excluded by %s", d.Hits, d.Score, d.Reason)
+	default:
+		return fmt.Sprintf("matched %q (score %g)", d.Hits, d.Score)
+	}
+}
+
+// Filter combines a matcher with exclusions that are evaluated after a positive match.
+type Filter struct {
+	matcher  Matcher
+	excludes []term
+	negation bool
+}
+
+// NewFilter creates a Filter that accepts the texts matched by matcher, unless they match one of the exclusions.
+// If negation is true, texts announcing that a threat is over or negating the matched keywords are excluded too.
+func NewFilter(matcher Matcher, negation bool, exclusions ...Exclusions) (*Filter, error) {
+	f := &Filter{matcher: matcher, negation: negation}
+
+	for _, ex := range exclusions {
+		for _, expr := range ex.Regexps {
+			rx, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("can't compile exclude_regexp: %w", err)
+			}
+
+			f.excludes = append(f.excludes, pattern{src: expr, rx: rx})
+		}
+
+		for _, s := range ex.Keywords {
+			if kw, ok := newKeyword(s); ok {
+				f.excludes = append(f.excludes, kw)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// Decide matches the text and evaluates the exclusions of a matched text.
+func (f *Filter) Decide(text string) Decision {
+	d := Decision{Result: f.matcher.Match(text)}
+	if !d.Matched {
+		return d
+	}
+
+	doc := newDocument(text)
+
+	for _, t := range f.excludes {
+		if ok, _, hits := t.match(doc); ok {
+			d.Excluded = true
+			d.Reason = fmt.Sprintf("exclusion %q", hits)
+			return d
+		}
+	}
+
+	if f.negation {
+		if reason, ok := negated(doc, d.Hits); ok {
+			d.Excluded = true
+			d.Reason = reason
+		}
+	}
+
+	return d
+}
+
+// negated reports whether the text announces that the threat is over, or negates one of the hits.
+// A negation word negates the word right after it, or, if it ends its clause, the whole clause.
+// A negation of another word, as in "Суми, немає світла, шахед летить", doesn't cancel the hits.
+func negated(d *document, hits []string) (string, bool) {
+	phrase := " " + strings.Join(d.words, " ") + " "
+
+	for _, p := range allClearPhrases {
+		if strings.Contains(phrase, " "+p+" ") {
+			return fmt.Sprintf("all-clear phrase %q", p), true
+		}
+	}
+
+	for _, clause := range clauseBreaks.Split(d.text, -1) {
+		words := normalize.Words(clause)
+
+		for i, w := range words {
+			if !slices.Contains(negationWords, w) {
+				continue
+			}
+
+			// The negated words are the next one, or the clause if the negation ends it.
+			negatedWords := words[:i]
+			if i+1 < len(words) {
+				negatedWords = words[i+1 : i+2]
+			}
+
+			for _, nw := range negatedWords {
+				if containsAny(nw, hits) {
+					return fmt.Sprintf("negation %q of %q", w, nw), true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// containsAny reports whether the word is one of the words of the hits, or has the same stem as one of them.
+func containsAny(word string, hits []string) bool {
+	stem := normalize.Stem(word)
+
+	for _, h := range hits {
+		for _, w := range normalize.Words(h) {
+			if w == word || normalize.Stem(w) == stem {
+				return true
+			}
+		}
+	}
+
+	return false
+}
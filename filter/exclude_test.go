@@ -0,0 +1,65 @@
+package filter
+
+import "testing"
+
+func TestFilterNegation(t *testing.T) {
+	en, err := New(map[string]Rule{
+		"alert": {AllOf: []string{"суми"}, AnyOf: []string{"шахед*", "ракет*"}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	m, _ := en.Matcher("alert")
+
+	f, err := NewFilter(m, true, Exclusions{Keywords: []string{"курс долара"}, Regexps: []string{`навчання`}})
+	if err != nil {
+		t.Fatalf("NewFilter() error = %v", err)
+	}
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Шахед летить на Суми", true},
+		{"Суми, немає світла, шахед летить", true},
+		{"Над Сумами немає світла. Шахеди летять з півночі", true},
+		{"Шахедів над Сумами більше немає", false},
+		{"Над Сумами немає шахедів", false},
+		{"Суми: ракети зникли", false},
+		{"Відбій загрози ракет для Сум", false},
+		{"Курс долара в Сумах і ракети", false},
+		{"НАВЧАННЯ: ракети над Сумами", false},
+	}
+
+	for _, tt := range tests {
+		if got := f.Decide(tt.text); got.Accepted() != tt.want {
+			t.Errorf("Decide(%q) = %s, want accepted %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFilterNegationDisabled(t *testing.T) {
+	m, _ := Keyword("шахед")
+
+	f, _ := NewFilter(m, false)
+
+	if got := f.Decide("Шахедів більше немає"); !got.Accepted() {
+		t.Errorf("Decide() = %s, want accepted without the negation check", got)
+	}
+}
+
+func TestFilterNegationRegexpSpan(t *testing.T) {
+	m, err := Regexp(`(?i)шахед.*суми`)
+	if err != nil {
+		t.Fatalf("Regexp() error = %v", err)
+	}
+
+	f, _ := NewFilter(m, true)
+
+	// The span hit contains "в" and "на", which only occur inside the negated word.
+	text := "Шахед летить в напрямку на Суми. Немає вибухів, наразі тримаємось"
+	if got := f.Decide(text); !got.Accepted() {
+		t.Errorf("Decide(%q) = %s, want accepted", text, got)
+	}
+}
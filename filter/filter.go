@@ -0,0 +1,352 @@
+// Package filter implements the rule engine that decides which source messages are alerts.
+//
+// Rules are named and reusable. Every rule is built from terms combined with all-of, any-of and
+// none-of semantics, where a term is either a keyword, a regular expression written between slashes
+// ("/балістик[аи]/"), or a reference to another rule ("@threats").
+//
+// Keywords are matched against the normalized words of a text (see package normalize), so they are
+// written as base words: "суми" matches "Сумах" and "Суми" but not "сумка". A keyword ending with "*"
+// matches any word starting with it ("балістик*"), and a keyword of several words matches a phrase.
+// Each rule has a weight that contributes to the score of the rules referencing it, and may
+// require a minimal score to match, which allows thresholds like "at least two threat indicators".
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"tg_alarm_bot/normalize"
+)
+
+var (
+	// ErrUnknownRule is returned when a rule or a reference to a rule can't be resolved.
+	ErrUnknownRule = errors.New("unknown rule")
+	// ErrRuleCycle is returned when rules reference each other in a cycle.
+	ErrRuleCycle = errors.New("rule references itself")
+)
+
+// Rule is the configuration of a named rule.
+type Rule struct {
+	AllOf    []string `json:"all_of,omitempty"`    // Terms that must all match.
+	AnyOf    []string `json:"any_of,omitempty"`    // Terms of which at least one must match.
+	NoneOf   []string `json:"none_of,omitempty"`   // Terms that must not match.
+	Weight   float64  `json:"weight,omitempty"`    // Score the rule contributes to the rules referencing it; 1 if unset.
+	MinScore float64  `json:"min_score,omitempty"` // Minimal total score of the matched all-of and any-of terms.
+}
+
+// Result is the outcome of matching a text.
+type Result struct {
+	Matched bool     // Whether the text matched.
+	Score   float64  // Total score of the matched terms.
+	Hits    []string // Keywords and patterns that matched the text.
+}
+
+// Matcher defines an interface for deciding whether a text is an alert.
+type Matcher interface {
+	Match(text string) Result
+}
+
+// Engine holds a set of compiled named rules.
+type Engine struct {
+	rules map[string]*rule
+}
+
+// rule is a compiled Rule.
+type rule struct {
+	name     string
+	allOf    []term
+	anyOf    []term
+	noneOf   []term
+	weight   float64
+	minScore float64
+}
+
+// term is a single compiled term of a rule.
+type term interface {
+	match(d *document) (bool, float64, []string)
+}
+
+// document is a text prepared for matching.
+type document struct {
+	text  string
+	words []string
+	stems []string
+}
+
+// keyword is a term matching a sequence of words by their stems.
+// If prefix is set, the last word matches any word starting with it.
+type keyword struct {
+	src    string
+	stems  []string
+	prefix bool
+}
+
+// pattern is a term matching a regular expression.
+type pattern struct {
+	src string
+	rx  *regexp.Regexp
+}
+
+// ref is a term matching another rule.
+type ref struct {
+	r *rule
+}
+
+// New compiles the named rules into an Engine.
+// It fails if a term can't be compiled, a referenced rule doesn't exist, or rules reference each other in a cycle.
+func New(rules map[string]Rule) (*Engine, error) {
+	en := &Engine{rules: make(map[string]*rule, len(rules))}
+
+	for name := range rules {
+		en.rules[name] = &rule{name: name}
+	}
+
+	// Compile rules in a stable order so that errors are reproducible.
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := en.compile(en.rules[name], rules[name]); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", name, err)
+		}
+	}
+
+	for _, name := range names {
+		if err := checkCycles(en.rules[name], map[*rule]bool{}); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", name, err)
+		}
+	}
+
+	return en, nil
+}
+
+// Matcher returns the matcher of the named rule.
+func (en *Engine) Matcher(name string) (Matcher, error) {
+	r, ok := en.rules[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRule, name)
+	}
+
+	return r, nil
+}
+
+// Regexp returns a matcher of a single regular expression, used for the legacy search_regexp setting.
+func Regexp(expr string) (Matcher, error) {
+	rx, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rule{name: expr, allOf: []term{pattern{src: expr, rx: rx}}, weight: 1}, nil
+}
+
+// Keyword returns a matcher of a single keyword, used for the region subscriptions of users.
+func Keyword(s string) (Matcher, error) {
+	kw, ok := newKeyword(s)
+	if !ok {
+		return nil, fmt.Errorf("keyword %q has no words", s)
+	}
+
+	return &rule{name: s, allOf: []term{kw}, weight: 1}, nil
+}
+
+// compile fills r from the rule configuration.
+func (en *Engine) compile(r *rule, cfg Rule) error {
+	var err error
+
+	if r.allOf, err = en.terms(cfg.AllOf); err != nil {
+		return err
+	}
+	if r.anyOf, err = en.terms(cfg.AnyOf); err != nil {
+		return err
+	}
+	if r.noneOf, err = en.terms(cfg.NoneOf); err != nil {
+		return err
+	}
+
+	r.weight = cfg.Weight
+	if r.weight == 0 {
+		r.weight = 1
+	}
+
+	r.minScore = cfg.MinScore
+
+	if len(r.allOf) == 0 && len(r.anyOf) == 0 {
+		return errors.New("rule has no all_of or any_of terms")
+	}
+
+	return nil
+}
+
+// terms compiles a list of terms.
+func (en *Engine) terms(src []string) ([]term, error) {
+	res := make([]term, 0, len(src))
+
+	for _, s := range src {
+		switch {
+		case strings.HasPrefix(s, "@"):
+			r, ok := en.rules[s[1:]]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownRule, s[1:])
+			}
+			res = append(res, ref{r: r})
+		case len(s) > 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/"):
+			rx, err := regexp.Compile("(?i)" + s[1:len(s)-1])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, pattern{src: s, rx: rx})
+		case s != "":
+			kw, ok := newKeyword(s)
+			if !ok {
+				return nil, fmt.Errorf("keyword %q has no words", s)
+			}
+			res = append(res, kw)
+		}
+	}
+
+	return res, nil
+}
+
+// newKeyword compiles a keyword. It reports false if the keyword has no words.
+func newKeyword(s string) (keyword, bool) {
+	kw := keyword{src: s, prefix: strings.HasSuffix(s, "*")}
+
+	words := normalize.Words(strings.TrimSuffix(s, "*"))
+	if len(words) == 0 {
+		return kw, false
+	}
+
+	kw.stems = normalize.Stems(words)
+	if kw.prefix {
+		kw.stems[len(kw.stems)-1] = words[len(words)-1]
+	}
+
+	return kw, true
+}
+
+// newDocument prepares the text for matching.
+func newDocument(text string) *document {
+	words := normalize.Words(text)
+
+	return &document{text: text, words: words, stems: normalize.Stems(words)}
+}
+
+// checkCycles fails if r references itself directly or through other rules.
+func checkCycles(r *rule, visiting map[*rule]bool) error {
+	if visiting[r] {
+		return fmt.Errorf("%w: %s", ErrRuleCycle, r.name)
+	}
+
+	visiting[r] = true
+	defer delete(visiting, r)
+
+	for _, terms := range [][]term{r.allOf, r.anyOf, r.noneOf} {
+		for _, t := range terms {
+			if ref, ok := t.(ref); ok {
+				if err := checkCycles(ref.r, visiting); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Match implements Matcher.
+func (r *rule) Match(text string) Result {
+	matched, score, hits := r.match(newDocument(text))
+
+	return Result{Matched: matched, Score: score, Hits: hits}
+}
+
+// match matches the document against the rule.
+func (r *rule) match(d *document) (bool, float64, []string) {
+	var score float64
+	var hits []string
+
+	for _, t := range r.allOf {
+		ok, s, h := t.match(d)
+		if !ok {
+			return false, 0, nil
+		}
+
+		score += s
+		hits = append(hits, h...)
+	}
+
+	if len(r.anyOf) > 0 {
+		found := false
+
+		for _, t := range r.anyOf {
+			if ok, s, h := t.match(d); ok {
+				found = true
+				score += s
+				hits = append(hits, h...)
+			}
+		}
+
+		if !found {
+			return false, 0, nil
+		}
+	}
+
+	for _, t := range r.noneOf {
+		if ok, _, _ := t.match(d); ok {
+			return false, 0, nil
+		}
+	}
+
+	if score < r.minScore {
+		return false, 0, nil
+	}
+
+	return true, score, hits
+}
+
+// match implements term. The hit is the matched words of the text.
+func (k keyword) match(d *document) (bool, float64, []string) {
+	n := len(k.stems)
+
+next:
+	for i := 0; i+n <= len(d.words); i++ {
+		for j, stem := range k.stems {
+			if k.prefix && j == n-1 {
+				if !strings.HasPrefix(d.words[i+j], stem) {
+					continue next
+				}
+			} else if d.stems[i+j] != stem {
+				continue next
+			}
+		}
+
+		return true, 1, []string{strings.Join(d.words[i:i+n], " ")}
+	}
+
+	return false, 0, nil
+}
+
+// match implements term.
+func (p pattern) match(d *document) (bool, float64, []string) {
+	if loc := p.rx.FindStringIndex(d.text); loc != nil {
+		return true, 1, []string{d.text[loc[0]:loc[1]]}
+	}
+
+	return false, 0, nil
+}
+
+// match implements term. A matched rule contributes its weight rather than its own score.
+func (t ref) match(d *document) (bool, float64, []string) {
+	ok, _, hits := t.r.match(d)
+	if !ok {
+		return false, 0, nil
+	}
+
+	return true, t.r.weight, hits
+}
@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEngine(t *testing.T) {
+	en, err := New(map[string]Rule{
+		"sumy":    {AnyOf: []string{"суми", "сумщин*"}},
+		"threats": {AnyOf: []string{"шахед", "балістик*", "/ракет[аи]/"}},
+		"alert":   {AllOf: []string{"@sumy", "@threats"}, NoneOf: []string{"навчання"}},
+		"strong":  {AnyOf: []string{"шахед", "мопед", "дрон"}, MinScore: 2},
+		"phrase":  {AnyOf: []string{"швидкісна ціль"}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		rule string
+		text string
+		want bool
+	}{
+		{"alert", "Шахеди на Сумах", true},
+		{"alert", "Балістика на Сумщину", true},
+		{"alert", "Ракети курсом на Суми", true},
+		{"alert", "Шахед на Конотоп", false},
+		{"alert", "Нова сумка для шахеда", false},
+		{"alert", "Шахед над Сумами, це навчання", false},
+		{"strong", "Шахед і мопед", true},
+		{"strong", "Шахед", false},
+		{"phrase", "Швидкісна ціль на Суми", true},
+		{"phrase", "Ціль швидкісна", false},
+	}
+
+	for _, tt := range tests {
+		m, err := en.Matcher(tt.rule)
+		if err != nil {
+			t.Fatalf("Matcher(%q) error = %v", tt.rule, err)
+		}
+
+		if got := m.Match(tt.text); got.Matched != tt.want {
+			t.Errorf("%s: Match(%q) = %+v, want matched %v", tt.rule, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEngineErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]Rule
+		want  error
+	}{
+		{"unknown reference", map[string]Rule{"a": {AnyOf: []string{"@b"}}}, ErrUnknownRule},
+		{"cycle", map[string]Rule{
+			"a": {AnyOf: []string{"@b"}},
+			"b": {AnyOf: []string{"@a"}},
+		}, ErrRuleCycle},
+	}
+
+	for _, tt := range tests {
+		if _, err := New(tt.rules); !errors.Is(err, tt.want) {
+			t.Errorf("%s: New() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := New(map[string]Rule{"a": {NoneOf: []string{"x"}}}); err == nil {
+		t.Error("New() accepted a rule without all_of or any_of terms")
+	}
+}
@@ -5,7 +5,8 @@ go 1.23
 toolchain go1.23.2
 
 require (
-	github.com/PuerkitoBio/goquery v1.10.0 // indirect
-	github.com/andybalholm/cascadia v1.3.2 // indirect
-	golang.org/x/net v0.29.0 // indirect
+	github.com/PuerkitoBio/goquery v1.10.0
+	golang.org/x/net v0.29.0
 )
+
+require github.com/andybalholm/cascadia v1.3.2 // indirect
@@ -0,0 +1,107 @@
+// Package journal keeps the recently forwarded alerts in memory, so the bot can report them on request.
+package journal
+
+import (
+	"context"
+	"sync"
+	"tg_alarm_bot/sources"
+	"time"
+)
+
+// Entry is a forwarded alert.
+type Entry struct {
+	Source string    // Name of the source the alert came from.
+	PostID string    // ID of the source post.
+	Label  string    // Label of the threat.
+	Text   string    // Plain text of the alert.
+	Time   time.Time // Time the alert was queued for delivery.
+}
+
+// Journal holds the latest alerts, up to a fixed number, and the time of the last alert of every source.
+// It is safe for concurrent use by several source consumers.
+type Journal struct {
+	mu      sync.Mutex
+	size    int
+	entries []Entry
+	last    map[string]time.Time
+}
+
+// New creates a new Journal keeping up to size alerts.
+func New(size int) *Journal {
+	return &Journal{
+		size: size,
+		last: make(map[string]time.Time),
+	}
+}
+
+// Add records an alert, dropping the oldest one if the journal is full.
+func (j *Journal) Add(e Entry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, e)
+	if len(j.entries) > j.size {
+		j.entries = j.entries[len(j.entries)-j.size:]
+	}
+
+	j.last[e.Source] = e.Time
+}
+
+// Recent returns up to n latest alerts, newest first.
+func (j *Journal) Recent(n int) []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	n = min(n, len(j.entries))
+	res := make([]Entry, 0, n)
+
+	for i := len(j.entries) - 1; i >= len(j.entries)-n; i-- {
+		res = append(res, j.entries[i])
+	}
+
+	return res
+}
+
+// LastAlert returns the time of the last alert of the source, or the zero time if there was none.
+func (j *Journal) LastAlert(source string) time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.last[source]
+}
+
+// Wrap returns a sources.Processor that records the new messages of the source in the journal
+// once next has processed them successfully.
+func (j *Journal) Wrap(next sources.Processor, source string) sources.Processor {
+	return &processor{
+		j:      j,
+		next:   next,
+		source: source,
+	}
+}
+
+// processor is a sources.Processor that records processed messages.
+type processor struct {
+	j      *Journal
+	next   sources.Processor
+	source string
+}
+
+// Process passes the message to the wrapped processor and records it, unless it is an edit or deletion.
+func (p *processor) Process(ctx context.Context, message sources.Message) error {
+	if err := p.next.Process(ctx, message); err != nil {
+		return err
+	}
+
+	if !message.Edit && !message.Deleted {
+		p.j.Add(Entry{
+			Source: p.source,
+			PostID: message.ID,
+			Label:  message.Classification.Label,
+			Text:   message.Text,
+			Time:   time.Now(),
+		})
+	}
+
+	return nil
+}
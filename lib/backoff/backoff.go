@@ -0,0 +1,18 @@
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Exponential returns the delay before the retry following the given zero-based attempt.
+// The delay starts at base, doubles with every attempt up to max and is randomized
+// between half and the full value, so that several clients don't retry in lockstep.
+func Exponential(attempt int, base, max time.Duration) time.Duration {
+	d := base << attempt
+	if attempt > 62 || d <= 0 || d > max {
+		d = max
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
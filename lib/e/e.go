@@ -3,7 +3,8 @@ package e
 import "fmt"
 
 // Wrap takes a custom message and an existing error, and combines them into a single error.
-// The returned error is formatted as "custom message: original error".
+// The returned error is formatted as "custom message: original error" and wraps the original error,
+// so it can still be inspected with errors.Is and errors.As.
 func Wrap(msg string, err error) error {
-	return fmt.Errorf("%s: %s", msg, err)
+	return fmt.Errorf("%s: %w", msg, err)
 }
@@ -0,0 +1,27 @@
+package runes
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Truncate cuts the text to at most max runes, ending it with an ellipsis if anything was cut.
+// The text is cut at the last whitespace if that keeps more than half of it, so words are not broken.
+func Truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	if max < 1 {
+		return ""
+	}
+
+	cut := string([]rune(text)[:max-1])
+
+	if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+
+	return strings.TrimSpace(cut) + "…"
+}
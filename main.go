@@ -1,112 +1,293 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
-	"io"
+	"fmt"
 	"log"
 	"os"
-	"sync"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"tg_alarm_bot/admin"
+	"tg_alarm_bot/classifier"
 	tg_client "tg_alarm_bot/client/telegram"
+	"tg_alarm_bot/config"
+	"tg_alarm_bot/consumer"
 	event_consumer "tg_alarm_bot/consumer/event-consumer"
 	source_consumer "tg_alarm_bot/consumer/source-consumer"
+	"tg_alarm_bot/dedup"
 	"tg_alarm_bot/events/telegram"
+	"tg_alarm_bot/journal"
+	"tg_alarm_bot/outbox"
+	"tg_alarm_bot/scheduler"
 	tg_sources "tg_alarm_bot/sources/telegram"
+	"tg_alarm_bot/storage/files"
+	"tg_alarm_bot/subscriptions"
+	"tg_alarm_bot/supervisor"
+	"time"
 )
 
 const (
-	tgBotHost = "api.telegram.org" // Telegram API host address.
-	batchSize = 100                // Number of events to process in a single batch.
-)
-
-var (
-	wg sync.WaitGroup
+	tgBotHost    = "api.telegram.org"     // Telegram API host address.
+	batchSize    = 100                    // Number of events to process in a single batch.
+	senders      = 4                      // Number of workers delivering messages from the outbox.
+	drainTimeout = 30 * time.Second       // Time given to the outbox to deliver queued messages on shutdown.
+	pollGap      = 250 * time.Millisecond // Minimal time between polls of any two sources.
+	journalSize  = 100                    // Number of recent alerts kept for the /last command.
 )
 
 func main() {
 	token := flag.String("t", "", "token for access to telegram bot")
-	filePath := flag.String("p", "./data/channels.json", "path to the file with channel data")
+	filePath := flag.String("p", "./data/channels.json", "path to the file with rules and channel data")
+	storagePath := flag.String("s", "./data/storage", "path to the directory with the bot state")
+	dedupWindow := flag.Duration("dedup-window", 3*time.Minute, "time window in which similar alerts to the same channel are suppressed")
 
+	flag.Usage = usage
 	flag.Parse()
 
+	// Open the outbox queue that keeps outgoing messages until they are delivered.
+	queue, err := outbox.Open(filepath.Join(*storagePath, "outbox"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Run a maintenance subcommand instead of the bot if one is given.
+	if flag.NArg() > 0 {
+		if err := runCommand(queue, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	// Create a new Telegram client using the provided bot token.
 	tg := tg_client.New(tgBotHost, mustToken(*token))
 
-	// Load the list of channels from the specified JSON file.
-	channels, err := loadChannels(*filePath)
+	// Load the rules and the list of channels from the specified JSON file.
+	cfg, err := config.Load(*filePath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Open the store that keeps track of seen and forwarded messages between restarts.
+	store, err := files.New(*storagePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the deduplicator shared by all sources, so the same alert posted by several
+	// channels is delivered to a destination channel only once.
+	deduplicator := dedup.New(*dedupWindow, dedup.DefaultThreshold)
+
+	// Stop the consumers on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Users subscribe to alerts in their private chats; chats that blocked the bot are unsubscribed.
+	subs := subscriptions.New(store, cfg.Topic)
+
+	// Start delivering outgoing messages, including the ones left pending from the previous run.
+	// Delivered copies are recorded in the store, so they can be updated when their posts are edited.
+	// Deliveries use their own context, so the outbox can be drained after the consumers stop.
+	sendCtx, cancelSend := context.WithCancel(context.Background())
+	defer cancelSend()
+
+	out := outbox.New(queue, tg, senders, store)
+	out.OnBlocked(subs.Blocked)
+	if err := out.Start(sendCtx); err != nil {
+		log.Fatal(err)
+	}
+
 	log.Printf("service started")
 
-	// Initialize the event processor for handling incoming Telegram bot events.
-	eventProcessor := telegram.New(tg)
-	// Initialize the event consumer to fetch and process events in batches.
-	eventConsumer := event_consumer.New(eventProcessor, eventProcessor, batchSize)
+	// The supervisor owns all the consumers and restarts the ones that fail.
+	sup := supervisor.New()
 
-	// Start a goroutine to run the event consumer.
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	// The journal keeps the recent alerts reported by the bot commands.
+	alerts := journal.New(journalSize)
 
-		if err := eventConsumer.Start(); err != nil {
-			log.Fatal(err)
+	// The scheduler spreads the polls of all the channels in time.
+	sched := scheduler.New(pollGap)
+
+	// The classifier tags alerts with the type and severity of the threat.
+	threats := classifier.New(cfg.Classification)
+
+	// The fetcher downloads the pages of all the channels over a shared pool of connections.
+	fetcher := tg_sources.NewFetcher()
+
+	// startSource runs a source consumer that fetches and processes the messages of a channel.
+	// It is used at startup and by the admin commands that add or reconfigure sources.
+	startSource := func(c tg_sources.Source) error {
+		// Resolve the rules and exclusions that decide which messages of the channel are alerts.
+		rules, err := cfg.Filter(c)
+		if err != nil {
+			return err
+		}
+
+		// Resolve the chats the alerts of the channel are forwarded to.
+		routes, err := cfg.Routes(c)
+		if err != nil {
+			return err
+		}
+
+		// Compile the template of the channel, used for the chats without a template of their own.
+		tmpl, err := cfg.Template(c)
+		if err != nil {
+			return err
 		}
-	}()
 
-	// For each channel, start a source consumer to fetch and process messages.
-	for _, c := range channels {
 		// Initialize the source processor for handling messages from the channel.
-		sourceProcessor := tg_sources.New(c.Name, c.URL, c.SearchRegexp, c.PhrasesToRemove, c.ToChannel, tg)
+		// The channel is fetched once and its alerts are fanned out to all the matching and subscribed chats.
+		sourceProcessor := tg_sources.New(c, rules, threats, routes, tmpl, subs, out, store, fetcher)
+		// The journal is inside the deduplicator, so dropped duplicates are not recorded.
+		processor := deduplicator.Wrap(alerts.Wrap(sourceProcessor, c.Name), c.Name, c.PhrasesToRemove)
+		schedule := sched.Schedule(c.Schedule())
+
+		factory := func(r consumer.Reporter) consumer.Consumer {
+			return source_consumer.New(sourceProcessor, processor, r, schedule)
+		}
+
+		if c.Paused {
+			return sup.AddPaused(ctx, c.Name, factory)
+		}
+
+		return sup.Add(ctx, c.Name, factory)
+	}
+
+	// For each channel, run a source consumer. The sources are started before the events are processed,
+	// so the admin commands can't change them in the meantime.
+	for _, c := range cfg.Sources {
+		if err := startSource(c); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-		// Start a goroutine to run the source consumer.
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
+	// The admins manage the sources with bot commands; the changes are saved to the config file.
+	manager := admin.New(cfg, *filePath, sup, startSource)
 
-			// Initialize and start the source consumer, and log a fatal error if it fails.
-			sourceConsumer := source_consumer.New(sourceProcessor, sourceProcessor)
-			if err := sourceConsumer.Start(); err != nil {
-				log.Fatal(err)
+	// Learn the username of the bot, so commands addressed to other bots in groups are ignored.
+	me, err := tg.Me(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Initialize the event processor for handling incoming Telegram bot events and commands.
+	eventProcessor := telegram.New(tg, telegram.Deps{
+		Supervisor: sup,
+		Journal:    alerts,
+		Sources: func() []telegram.SourceInfo {
+			var res []telegram.SourceInfo
+			for _, c := range manager.Sources() {
+				res = append(res, telegram.SourceInfo{Name: c.Name, URL: c.URL, Paused: c.Paused})
+			}
+
+			return res
+		},
+		Subscriptions: subs,
+		// The rules of the sources are offered as topics in the subscription menu.
+		Topics: func() []string {
+			var topics []string
+			for _, c := range manager.Sources() {
+				if c.Rule != "" && !slices.Contains(topics, c.Rule) {
+					topics = append(topics, c.Rule)
+				}
 			}
-		}()
+
+			return topics
+		},
+		Admin:       manager,
+		BotUsername: me.Username,
+	})
+
+	// Run the event consumer that fetches and processes events in batches.
+	err = sup.Add(ctx, "events", func(r consumer.Reporter) consumer.Consumer {
+		c := event_consumer.New(eventProcessor, eventProcessor, r, batchSize)
+		return &c
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	wg.Wait()
-}
+	<-ctx.Done()
+	log.Printf("shutting down")
 
-// mustToken parses the token flag from the command-line arguments.
-// If the token flag ("-t") is not specified, the function logs a fatal error and exits the program.
-// If the token is provided, it returns the token as a string.
-func mustToken(token string) string {
-	if token == "" {
-		log.Fatal("token is not specified")
+	// Wait for the consumers to finish their batches in flight and then drain the outbox.
+	sup.Wait()
+
+	drained := make(chan struct{})
+	go func() {
+		out.Close()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+		log.Printf("outbox not drained in %s, the rest is delivered on the next start", drainTimeout)
+		cancelSend()
+		<-drained
 	}
 
-	return token
+	log.Printf("service stopped")
 }
 
-// loadChannels loads the Telegram channel configurations from a JSON file.
-// It reads the file and unmarshals the JSON data into a slice of Source structs.
-// Returns the loaded channels or an error if the loading fails.
-func loadChannels(filePath string) ([]tg_sources.Source, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
+// usage prints the command-line usage of the program, including the maintenance subcommands.
+func usage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintf(out, "Usage:\n")
+	fmt.Fprintf(out, "  %s [flags]                    run the bot\n", os.Args[0])
+	fmt.Fprintf(out, "  %s [flags] deadletter list    list undelivered messages\n", os.Args[0])
+	fmt.Fprintf(out, "  %s [flags] deadletter replay  queue undelivered messages for delivery on the next start\n", os.Args[0])
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// runCommand runs a maintenance subcommand given by args.
+func runCommand(queue *outbox.Queue, args []string) error {
+	if len(args) != 2 || args[0] != "deadletter" {
+		flag.Usage()
+		return fmt.Errorf("unknown command: %s", strings.Join(args, " "))
 	}
 
-	defer file.Close()
+	switch args[1] {
+	case "list":
+		items, err := queue.Dead()
+		if err != nil {
+			return err
+		}
 
-	byteValue, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
+		for _, item := range items {
+			fmt.Printf("%d\t%s\tchat %d\t%s %s\t%d attempts\t%s\n%s\n\n",
+				item.ID, item.CreatedAt.Format(time.RFC3339), item.ChatID, item.Source, item.PostID, item.Attempts, item.Error, item.Text)
+		}
+
+		fmt.Printf("%d dead letters\n", len(items))
+	case "replay":
+		n, err := queue.Replay()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d dead letters queued for delivery\n", n)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown deadletter command: %s", args[1])
 	}
 
-	var channels []tg_sources.Source
-	if err := json.Unmarshal(byteValue, &channels); err != nil {
-		return nil, err
+	return nil
+}
+
+// mustToken parses the token flag from the command-line arguments.
+// If the token flag ("-t") is not specified, the function logs a fatal error and exits the program.
+// If the token is provided, it returns the token as a string.
+func mustToken(token string) string {
+	if token == "" {
+		log.Fatal("token is not specified")
 	}
 
-	return channels, nil
+	return token
 }
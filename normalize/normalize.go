@@ -0,0 +1,155 @@
+// Package normalize prepares Ukrainian and Russian texts for keyword matching.
+// It lowercases the text, folds the variants of the apostrophe and the Latin letters that look like
+// Cyrillic ones in Cyrillic words, splits the text into words and reduces the words to their stems,
+// so that a rule written with a base word ("суми") matches its inflected forms ("Сумах", "Суми")
+// but not other words sharing the first letters ("сумка").
+package normalize
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minStem is the minimal number of runes left in a word after stripping an ending.
+const minStem = 3
+
+// apostrophes lists the characters used in place of the apostrophe.
+var apostrophes = map[rune]bool{
+	'\'': true, '’': true, 'ʼ': true, '‘': true, '`': true, '´': true, '′': true, 'ʹ': true,
+}
+
+// lookalikes maps the Latin letters to the Cyrillic letters they look like.
+var lookalikes = map[rune]rune{
+	'A': 'А', 'B': 'В', 'C': 'С', 'E': 'Е', 'H': 'Н', 'I': 'І', 'K': 'К', 'M': 'М',
+	'O': 'О', 'P': 'Р', 'T': 'Т', 'X': 'Х', 'Y': 'У',
+	'a': 'а', 'c': 'с', 'e': 'е', 'i': 'і', 'o': 'о', 'p': 'р', 'x': 'х', 'y': 'у',
+}
+
+// endings lists the inflectional endings of Ukrainian and Russian nouns and adjectives,
+// longest first, so that the longest matching ending is stripped.
+var endings = func() []string {
+	list := []string{
+		// Ukrainian.
+		"ами", "ями", "ові", "еві", "єві", "ого", "ому", "ими", "іми", "ах", "ях", "ів", "їв", "ою", "ею", "єю",
+		"ом", "ем", "єм", "ам", "ям", "ий", "ій", "им", "их", "ої", "а", "я", "о", "е", "є", "и", "і", "ї", "у", "ю", "ь", "й",
+		// Russian, besides the endings shared with Ukrainian.
+		"его", "ему", "ыми", "ов", "ев", "ей", "ой", "ый", "ая", "яя", "ое", "ее", "ые", "ых", "ым", "ы",
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return utf8.RuneCountInString(list[i]) > utf8.RuneCountInString(list[j])
+	})
+
+	return list
+}()
+
+// exceptions maps the words whose stripped stem would be the stem of an unrelated word to their own stems,
+// e.g. "сума" (a sum of money), which would otherwise be taken for the city of Суми.
+var exceptions = map[string]string{
+	"сума": "сума", "суму": "сума", "сумі": "сума", "сумою": "сума",
+}
+
+// Text lowercases the text, folds the apostrophe variants to "'", the Russian "ё" to "е",
+// and the Latin look-alike letters in words containing Cyrillic letters to the Cyrillic ones.
+func Text(s string) string {
+	runes := []rune(s)
+
+	for start := 0; start < len(runes); {
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+
+		if end == start {
+			start++
+			continue
+		}
+
+		foldWord(runes[start:end])
+		start = end
+	}
+
+	return strings.ToLower(string(runes))
+}
+
+// Words normalizes the text and splits it into words.
+// Apostrophes and hyphens are kept inside words, e.g. "м'ясо" or "х-101".
+func Words(s string) []string {
+	fields := strings.FieldsFunc(Text(s), func(r rune) bool {
+		return !isWordRune(r) && r != '-'
+	})
+
+	words := fields[:0]
+
+	for _, f := range fields {
+		if f = strings.Trim(f, "'-"); f != "" {
+			words = append(words, f)
+		}
+	}
+
+	return words
+}
+
+// Stem reduces a normalized word to its stem by stripping the longest inflectional ending
+// that leaves at least minStem runes. The words listed in exceptions get their own stems instead.
+func Stem(word string) string {
+	if stem, ok := exceptions[word]; ok {
+		return stem
+	}
+
+	n := utf8.RuneCountInString(word)
+
+	for _, ending := range endings {
+		if strings.HasSuffix(word, ending) && n-utf8.RuneCountInString(ending) >= minStem {
+			return strings.TrimSuffix(word, ending)
+		}
+	}
+
+	return word
+}
+
+// Stems returns the stems of the words.
+func Stems(words []string) []string {
+	res := make([]string, len(words))
+
+	for i, w := range words {
+		res[i] = Stem(w)
+	}
+
+	return res
+}
+
+// isWordRune reports whether the rune is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || apostrophes[r]
+}
+
+// foldWord folds the apostrophes and "ё" in the word, and the Latin look-alikes if the word has Cyrillic letters.
+func foldWord(word []rune) {
+	cyrillic := false
+
+	for i, r := range word {
+		switch {
+		case apostrophes[r]:
+			word[i] = '\''
+		case r == 'ё':
+			word[i] = 'е'
+		case r == 'Ё':
+			word[i] = 'Е'
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic = true
+		}
+	}
+
+	if !cyrillic {
+		return
+	}
+
+	for i, r := range word {
+		if c, ok := lookalikes[r]; ok {
+			word[i] = c
+		}
+	}
+}
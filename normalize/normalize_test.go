@@ -0,0 +1,57 @@
+package normalize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"суми", "сум"},
+		{"сумах", "сум"},
+		{"сумами", "сум"},
+		{"сумка", "сумк"},
+		// A sum of money is not the city.
+		{"сума", "сума"},
+		{"сумою", "сума"},
+		{"сумщина", "сумщин"},
+		{"сумщині", "сумщин"},
+		{"шахеди", "шахед"},
+		{"шахедів", "шахед"},
+		{"балістики", "балістик"},
+		{"ракета", "ракет"},
+		{"ракетой", "ракет"},
+		{"ракеты", "ракет"},
+		// Endings are not stripped below the minimal stem length.
+		{"кав", "кав"},
+		{"ніж", "ніж"},
+	}
+
+	for _, tt := range tests {
+		if got := Stem(tt.word); got != tt.want {
+			t.Errorf("Stem(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Шахед на СУМИ!", []string{"шахед", "на", "суми"}},
+		{"Ракета Х-101 над м’ясокомбінатом", []string{"ракета", "х-101", "над", "м'ясокомбінатом"}},
+		// Latin look-alikes are folded only in Cyrillic words.
+		{"Cумы and Sumy", []string{"сумы", "and", "sumy"}},
+		{"Ёлки -- 'цитата'", []string{"елки", "цитата"}},
+	}
+
+	for _, tt := range tests {
+		if got := Words(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Words(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"sync"
+	"time"
+)
+
+// chatQueues holds the items waiting for delivery per destination chat and hands them to the sender workers.
+// Only the first item of a chat is handed out at a time, so the items of a chat are delivered in the order
+// they were pushed, while an item waiting for a retry holds back only the items of its own chat.
+// Pushing never blocks, since the items are already stored in the Queue.
+type chatQueues struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   map[int][]Item // Pending items per chat; the first one is being delivered or waiting for a retry.
+	ready   []int          // Chats whose first item can be delivered now, in the order they became ready.
+	pending int            // Total number of pending items.
+	closed  bool           // Whether no more items are pushed.
+	stopped bool           // Whether the workers stop without delivering the pending items.
+}
+
+// newChatQueues creates empty chat queues.
+func newChatQueues() *chatQueues {
+	q := &chatQueues{items: make(map[int][]Item)}
+	q.cond = sync.NewCond(&q.mu)
+
+	return q
+}
+
+// push appends the item to the queue of its chat.
+func (q *chatQueues) push(item Item) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items[item.ChatID] = append(q.items[item.ChatID], item)
+	q.pending++
+
+	// A chat with other items is already ready, being delivered or waiting for a retry.
+	if len(q.items[item.ChatID]) == 1 {
+		q.ready = append(q.ready, item.ChatID)
+		q.cond.Signal()
+	}
+}
+
+// next blocks until the first item of a chat can be delivered and returns it.
+// It reports false once the queues are closed and every item is delivered, or once they are stopped.
+func (q *chatQueues) next() (Item, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.ready) == 0 && !q.stopped && !(q.closed && q.pending == 0) {
+		q.cond.Wait()
+	}
+
+	if q.stopped || len(q.ready) == 0 {
+		return Item{}, false
+	}
+
+	chatID := q.ready[0]
+	q.ready = q.ready[1:]
+
+	return q.items[chatID][0], true
+}
+
+// done records the outcome of delivering an item returned by next.
+// If retry is positive, the item replaces the first item of its chat and is handed out again after retry;
+// otherwise it is removed and the next item of the chat becomes ready.
+func (q *chatQueues) done(item Item, retry time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	chatID := item.ChatID
+
+	if retry > 0 {
+		q.items[chatID][0] = item
+
+		time.AfterFunc(retry, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+
+			q.ready = append(q.ready, chatID)
+			q.cond.Signal()
+		})
+
+		return
+	}
+
+	q.pending--
+
+	if rest := q.items[chatID][1:]; len(rest) > 0 {
+		q.items[chatID] = rest
+		q.ready = append(q.ready, chatID)
+		q.cond.Signal()
+	} else {
+		delete(q.items, chatID)
+	}
+
+	if q.closed && q.pending == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+// close makes next report false once every pending item is delivered. No item may be pushed after close.
+func (q *chatQueues) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// stop makes next report false immediately, leaving the pending items in the Queue for the next run.
+func (q *chatQueues) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.stopped = true
+	q.cond.Broadcast()
+}
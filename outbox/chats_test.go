@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChatQueuesRetryDoesNotBlockOtherChats(t *testing.T) {
+	q := newChatQueues()
+
+	q.push(Item{ID: 1, ChatID: 10})
+	q.push(Item{ID: 2, ChatID: 10})
+	q.push(Item{ID: 3, ChatID: 20})
+
+	item := mustNext(t, q)
+	if item.ID != 1 {
+		t.Fatalf("next() = item %d, want 1", item.ID)
+	}
+
+	q.done(item, 200*time.Millisecond)
+
+	start := time.Now()
+
+	// The other chat is served while the first one waits for its retry.
+	if item := mustNext(t, q); item.ID != 3 {
+		t.Fatalf("next() = item %d, want 3", item.ID)
+	} else {
+		q.done(item, 0)
+	}
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("other chat waited %v behind a retry", elapsed)
+	}
+
+	// The retried item is handed out again before the next item of its chat.
+	if item := mustNext(t, q); item.ID != 1 {
+		t.Fatalf("next() = item %d, want 1", item.ID)
+	} else {
+		q.done(item, 0)
+	}
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("retry handed out after %v, want about 200ms", elapsed)
+	}
+
+	if item := mustNext(t, q); item.ID != 2 {
+		t.Fatalf("next() = item %d, want 2", item.ID)
+	}
+}
+
+func TestChatQueuesPushDoesNotBlock(t *testing.T) {
+	q := newChatQueues()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10000; i++ {
+			q.push(Item{ID: int64(i), ChatID: 10})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("push blocked without workers")
+	}
+}
+
+func TestChatQueuesClose(t *testing.T) {
+	q := newChatQueues()
+
+	q.push(Item{ID: 1, ChatID: 10})
+	q.close()
+
+	item := mustNext(t, q)
+	q.done(item, 0)
+
+	if _, ok := q.next(); ok {
+		t.Error("next() reported an item after the queues were closed and drained")
+	}
+}
+
+func TestChatQueuesStop(t *testing.T) {
+	q := newChatQueues()
+
+	q.push(Item{ID: 1, ChatID: 10})
+	q.stop()
+
+	if _, ok := q.next(); ok {
+		t.Error("next() reported an item after the queues were stopped")
+	}
+}
+
+// mustNext returns the next item of the queues, failing the test if none is handed out in time.
+func mustNext(t *testing.T, q *chatQueues) Item {
+	t.Helper()
+
+	type result struct {
+		item Item
+		ok   bool
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		item, ok := q.next()
+		ch <- result{item, ok}
+	}()
+
+	select {
+	case r := <-ch:
+		if !r.ok {
+			t.Fatal("next() reported no items")
+		}
+		return r.item
+	case <-time.After(time.Second):
+		t.Fatal("next() blocked")
+		return Item{}
+	}
+}
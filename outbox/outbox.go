@@ -0,0 +1,326 @@
+// Package outbox implements durable delivery of outgoing alerts.
+// Processed messages are appended to an on-disk queue and delivered by a pool of sender workers,
+// which retry failed deliveries and keep the order of messages sent to the same chat.
+// A chat waiting for a retry doesn't hold back the deliveries to the other chats.
+// Items that can't be delivered end up in a dead-letter file, from which they can be replayed.
+package outbox
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"tg_alarm_bot/client/telegram"
+	"tg_alarm_bot/lib/e"
+	"tg_alarm_bot/storage"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxAttempts is the number of delivery attempts made before an item is moved to the dead-letter file.
+	maxAttempts = 5
+	// retryDelay is the delay before the first repeated delivery attempt; it doubles with every attempt.
+	retryDelay = 5 * time.Second
+	// maxGroupSize is the maximum number of media in an album.
+	maxGroupSize = 10
+)
+
+// Item is a single outgoing message stored in the outbox.
+type Item struct {
+	ID            int64     `json:"id"`                        // Unique ID assigned by the queue, growing in push order.
+	ChatID        int       `json:"chat_id"`                   // ID of the destination chat.
+	ThreadID      int       `json:"thread_id,omitempty"`       // ID of the forum topic of the destination chat.
+	Text          string    `json:"text"`                      // Text of the message, or the caption of its media.
+	Media         []Media   `json:"media,omitempty"`           // Media attached to the message.
+	EditMessageID int       `json:"edit_message_id,omitempty"` // ID of the message to replace the text of, instead of sending a new one.
+	Caption       bool      `json:"caption,omitempty"`         // Whether the edited text, or the text of the replied message, is a caption.
+	ReplyTo       int       `json:"reply_to,omitempty"`        // ID of the message to reply to.
+	Hash          string    `json:"hash,omitempty"`            // Hash of the source post text the message was made from.
+	Delete        bool      `json:"delete,omitempty"`          // Whether to delete the message with EditMessageID instead of editing it.
+	Retracted     bool      `json:"retracted,omitempty"`       // Whether the item retracts the copy of a deleted post, which is no longer tracked.
+	ParseMode     string    `json:"parse_mode"`                // Parse mode of the text, e.g. "HTML".
+	Silent        bool      `json:"silent,omitempty"`          // Whether to deliver the message without a notification.
+	Source        string    `json:"source,omitempty"`          // Name of the source the message came from.
+	PostID        string    `json:"post_id,omitempty"`         // ID of the source post the message was made from.
+	CreatedAt     time.Time `json:"created_at"`                // Time the item was pushed to the outbox.
+	Attempts      int       `json:"attempts"`                  // Number of failed delivery attempts.
+	Error         string    `json:"error,omitempty"`           // Error of the last failed delivery attempt.
+}
+
+// Media is a photo, video or document attached to an item.
+type Media struct {
+	Type string `json:"type"` // Type of the media: "photo", "video" or "document".
+	URL  string `json:"url"`  // URL Telegram downloads the media from.
+}
+
+// Outbox delivers the items of a Queue to Telegram using a pool of workers.
+// The workers deliver one item of a chat at a time, so items for the same chat
+// are delivered in the order they were pushed.
+type Outbox struct {
+	queue    *Queue
+	tg       *telegram.Client
+	forwards storage.ForwardStore
+	blocked  func(chatID int)
+	chats    *chatQueues
+	workers  int
+	wg       sync.WaitGroup
+}
+
+// New creates a new Outbox that delivers the items of queue using the Telegram client
+// and the given number of sender workers. Delivered copies of source posts are recorded in forwards.
+func New(queue *Queue, tg *telegram.Client, workers int, forwards storage.ForwardStore) *Outbox {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Outbox{
+		queue:    queue,
+		tg:       tg,
+		forwards: forwards,
+		chats:    newChatQueues(),
+		workers:  workers,
+	}
+}
+
+// Start starts the sender workers and hands them the items left pending from the previous run.
+// It must be called before any item is pushed. The workers deliver items until Close is called;
+// cancelling the context aborts the deliveries in progress, leaving the items pending for the next run.
+func (o *Outbox) Start(ctx context.Context) error {
+	context.AfterFunc(ctx, o.chats.stop)
+
+	for i := 0; i < o.workers; i++ {
+		o.wg.Add(1)
+		go o.work(ctx)
+	}
+
+	items, err := o.queue.Pending()
+	if err != nil {
+		return e.Wrap("can't start outbox", err)
+	}
+
+	if len(items) > 0 {
+		log.Printf("outbox: resuming delivery of %d pending items", len(items))
+	}
+
+	for _, item := range items {
+		o.chats.push(item)
+	}
+
+	return nil
+}
+
+// OnBlocked sets the function called with the ID of a private chat that rejected an item because the bot
+// can't send messages to it anymore, i.e. because the user blocked the bot. It must be called before Start.
+func (o *Outbox) OnBlocked(f func(chatID int)) {
+	o.blocked = f
+}
+
+// Close stops accepting new items and waits until the workers have delivered the pending items.
+// No item may be pushed after Close is called.
+func (o *Outbox) Close() {
+	o.chats.close()
+	o.wg.Wait()
+}
+
+// Push durably stores the item and schedules its delivery.
+func (o *Outbox) Push(item Item) error {
+	item, err := o.queue.Push(item)
+	if err != nil {
+		return err
+	}
+
+	o.chats.push(item)
+
+	return nil
+}
+
+// work delivers the items handed out by the chat queues one by one.
+// Once the context is done, it stops and leaves the remaining items pending.
+func (o *Outbox) work(ctx context.Context) {
+	defer o.wg.Done()
+
+	for {
+		item, ok := o.chats.next()
+		if !ok {
+			return
+		}
+
+		item, retry := o.deliver(ctx, item)
+		if ctx.Err() != nil {
+			return
+		}
+
+		o.chats.done(item, retry)
+	}
+}
+
+// deliver makes an attempt to send the item and returns the item with the attempt recorded and the delay
+// before the next attempt, or zero if the item needs no more attempts.
+// Delivered items are recorded in the forward store and removed from the queue, while items rejected by the API
+// or failing maxAttempts times are moved to the dead-letter file. Items for private chats that blocked the bot
+// are dropped and reported to the OnBlocked function instead, since they can't be delivered later either.
+// If the context is done, the item is left pending.
+func (o *Outbox) deliver(ctx context.Context, item Item) (Item, time.Duration) {
+	messageID, caption, err := o.send(ctx, item)
+	if err == nil {
+		o.record(item, messageID, caption)
+
+		if err := o.queue.Ack(item.ID); err != nil {
+			log.Printf("[ERR] outbox: %s", err.Error())
+		}
+
+		return item, 0
+	}
+
+	if ctx.Err() != nil {
+		return item, 0
+	}
+
+	item.Attempts++
+	item.Error = err.Error()
+
+	apiErr, ok := telegram.AsAPIError(err)
+
+	// Only private chats of subscribers are dropped; configured channels and groups that rejected the bot
+	// need the attention of an admin, so their items are dead-lettered.
+	if ok && apiErr.Blocked() && o.blocked != nil && item.ChatID > 0 {
+		log.Printf("[WARN] outbox: chat %d blocked the bot, dropping item %d: %s", item.ChatID, item.ID, err)
+
+		o.blocked(item.ChatID)
+
+		if err := o.queue.Ack(item.ID); err != nil {
+			log.Printf("[ERR] outbox: %s", err.Error())
+		}
+
+		return item, 0
+	}
+
+	// The client already retries temporary failures, so other API errors are permanent.
+	if (ok && !apiErr.Temporary()) || item.Attempts >= maxAttempts {
+		log.Printf("[ERR] outbox: can't deliver item %d to chat %d, moving to dead letters: %s", item.ID, item.ChatID, err)
+
+		if err := o.queue.Bury(item); err != nil {
+			log.Printf("[ERR] outbox: %s", err.Error())
+		}
+
+		return item, 0
+	}
+
+	if err := o.queue.Update(item); err != nil {
+		log.Printf("[ERR] outbox: %s", err.Error())
+	}
+
+	delay := retryDelay << (item.Attempts - 1)
+	log.Printf("[WARN] outbox: can't deliver item %d to chat %d, retrying in %s: %s", item.ID, item.ChatID, delay, err)
+
+	return item, delay
+}
+
+// send makes a single attempt to deliver the item and returns the ID of the message that holds its text
+// and whether the text is a caption. An item with an EditMessageID replaces the text or caption of that message,
+// or deletes the message if Delete is set.
+// Other items are sent as new messages; an item with media is sent as a photo, video or document
+// with the text as its caption, or as an album if it has several media. Media are dropped if the text
+// doesn't fit in a caption, so that the text is never lost.
+func (o *Outbox) send(ctx context.Context, item Item) (int, bool, error) {
+	opts := telegram.SendOptions{
+		ParseMode:           item.ParseMode,
+		DisableNotification: item.Silent,
+		ReplyToMessageID:    item.ReplyTo,
+		MessageThreadID:     item.ThreadID,
+	}
+
+	if item.Delete {
+		err := o.tg.DeleteMessage(ctx, item.ChatID, item.EditMessageID)
+
+		// The message may have already been deleted by hand.
+		if apiErr, ok := telegram.AsAPIError(err); ok && strings.Contains(apiErr.Description, "message to delete not found") {
+			err = nil
+		}
+
+		return item.EditMessageID, item.Caption, err
+	}
+
+	if item.EditMessageID != 0 {
+		var err error
+		if item.Caption {
+			err = o.tg.EditMessageCaption(ctx, item.ChatID, item.EditMessageID, item.Text, opts)
+		} else {
+			err = o.tg.EditMessageText(ctx, item.ChatID, item.EditMessageID, item.Text, opts)
+		}
+
+		// An edit that changes nothing visible is rejected, but the copy is up to date anyway.
+		if apiErr, ok := telegram.AsAPIError(err); ok && strings.Contains(apiErr.Description, "message is not modified") {
+			err = nil
+		}
+
+		return item.EditMessageID, item.Caption, err
+	}
+
+	media := item.Media
+	if len(media) > maxGroupSize {
+		media = media[:maxGroupSize]
+	}
+
+	if len(media) > 0 && utf8.RuneCountInString(item.Text) > telegram.MaxCaptionLength {
+		log.Printf("[WARN] outbox: text of item %d is too long for a caption, sending it without media", item.ID)
+		media = nil
+	}
+
+	if len(media) > 1 {
+		group := make([]telegram.InputMedia, len(media))
+		for i, m := range media {
+			group[i] = telegram.InputMedia{Type: m.Type, Media: m.URL}
+		}
+		group[0].Caption = item.Text
+
+		id, err := o.tg.SendMediaGroup(ctx, item.ChatID, group, opts)
+
+		return id, true, err
+	}
+
+	if len(media) == 1 {
+		var id int
+		var err error
+
+		switch media[0].Type {
+		case telegram.MediaPhoto:
+			id, err = o.tg.SendPhoto(ctx, item.ChatID, media[0].URL, item.Text, opts)
+		case telegram.MediaVideo:
+			id, err = o.tg.SendVideo(ctx, item.ChatID, media[0].URL, item.Text, opts)
+		default:
+			id, err = o.tg.SendDocument(ctx, item.ChatID, media[0].URL, item.Text, opts)
+		}
+
+		return id, true, err
+	}
+
+	id, err := o.tg.SendMessage(ctx, item.ChatID, item.Text, opts)
+
+	return id, false, err
+}
+
+// record saves the delivered copy of a source post in the forward store, so that it can be updated
+// when the post is edited. Replies to edited posts are recorded as updates of the original copy.
+func (o *Outbox) record(item Item, messageID int, caption bool) {
+	if o.forwards == nil || item.Source == "" || item.PostID == "" || item.Retracted {
+		return
+	}
+
+	if item.ReplyTo != 0 {
+		messageID, caption = item.ReplyTo, item.Caption
+	}
+
+	err := o.forwards.SaveForward(item.Source, item.PostID, storage.Forward{
+		ChatID:    item.ChatID,
+		MessageID: messageID,
+		Caption:   caption,
+		Hash:      item.Hash,
+		Text:      item.Text,
+		Time:      time.Now(),
+	})
+	if err != nil {
+		log.Printf("[ERR] outbox: %s", err.Error())
+	}
+}
@@ -0,0 +1,246 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"tg_alarm_bot/lib/e"
+	"tg_alarm_bot/lib/file"
+	"time"
+)
+
+const (
+	// defaultPerm is the permission used when creating the queue directories.
+	defaultPerm = 0774
+	// pendingDir is the directory holding one file per item waiting to be delivered.
+	pendingDir = "pending"
+	// deadLetterFile is the file that undeliverable items are appended to, one JSON object per line.
+	deadLetterFile = "dead.jsonl"
+)
+
+// Queue is a durable on-disk queue of outgoing items.
+// Every pending item is stored in its own file named after the item ID, so items survive restarts
+// and are read back in the order they were pushed. Undeliverable items are moved to a dead-letter file.
+type Queue struct {
+	basePath string
+	mu       sync.Mutex
+	lastID   int64
+}
+
+// Open opens the queue stored in basePath, creating the directories if necessary.
+func Open(basePath string) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Join(basePath, pendingDir), defaultPerm); err != nil {
+		return nil, e.Wrap("can't open outbox", err)
+	}
+
+	return &Queue{basePath: basePath}, nil
+}
+
+// Push assigns the item an ID, stores it as pending and returns the stored item.
+func (q *Queue) Push(item Item) (Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// IDs are based on the current time so that they keep growing across restarts.
+	id := time.Now().UnixNano()
+	if id <= q.lastID {
+		id = q.lastID + 1
+	}
+
+	q.lastID = id
+
+	item.ID = id
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+
+	if err := writeFile(q.itemPath(id), item); err != nil {
+		return Item{}, e.Wrap("can't push item to outbox", err)
+	}
+
+	return item, nil
+}
+
+// Pending returns all the pending items ordered by ID.
+func (q *Queue) Pending() ([]Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(q.basePath, pendingDir))
+	if err != nil {
+		return nil, e.Wrap("can't read pending items", err)
+	}
+
+	items := make([]Item, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(q.basePath, pendingDir, entry.Name()))
+		if err != nil {
+			return nil, e.Wrap("can't read pending items", err)
+		}
+
+		var item Item
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, e.Wrap(fmt.Sprintf("can't decode pending item %s", entry.Name()), err)
+		}
+
+		items = append(items, item)
+
+		if item.ID > q.lastID {
+			q.lastID = item.ID
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+	return items, nil
+}
+
+// Update overwrites the stored copy of a pending item, e.g. to record a failed attempt.
+func (q *Queue) Update(item Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := writeFile(q.itemPath(item.ID), item); err != nil {
+		return e.Wrap("can't update outbox item", err)
+	}
+
+	return nil
+}
+
+// Ack removes a delivered item from the queue.
+func (q *Queue) Ack(id int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := os.Remove(q.itemPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return e.Wrap("can't ack outbox item", err)
+	}
+
+	return nil
+}
+
+// Bury moves an undeliverable item from the queue to the dead-letter file.
+func (q *Queue) Bury(item Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return e.Wrap("can't bury outbox item", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(q.basePath, deadLetterFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0664)
+	if err != nil {
+		return e.Wrap("can't bury outbox item", err)
+	}
+
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return e.Wrap("can't bury outbox item", err)
+	}
+
+	if err := os.Remove(q.itemPath(item.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return e.Wrap("can't bury outbox item", err)
+	}
+
+	return nil
+}
+
+// Dead returns the items in the dead-letter file in the order they were buried.
+func (q *Queue) Dead() ([]Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.dead()
+}
+
+// Replay moves every item from the dead-letter file back to the pending items, resetting their attempts.
+// It returns the number of replayed items.
+func (q *Queue) Replay() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.dead()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		item.Attempts = 0
+		item.Error = ""
+
+		if err := writeFile(q.itemPath(item.ID), item); err != nil {
+			return 0, e.Wrap("can't replay outbox item", err)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(q.basePath, deadLetterFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, e.Wrap("can't clear dead letters", err)
+	}
+
+	return len(items), nil
+}
+
+// dead reads the dead-letter file. The caller must hold the lock.
+func (q *Queue) dead() ([]Item, error) {
+	f, err := os.Open(filepath.Join(q.basePath, deadLetterFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, e.Wrap("can't read dead letters", err)
+	}
+
+	defer f.Close()
+
+	var items []Item
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var item Item
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return nil, e.Wrap("can't decode dead letter", err)
+		}
+
+		items = append(items, item)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, e.Wrap("can't read dead letters", err)
+	}
+
+	return items, nil
+}
+
+// itemPath returns the path of the file holding the pending item with the given ID.
+func (q *Queue) itemPath(id int64) string {
+	return filepath.Join(q.basePath, pendingDir, fmt.Sprintf("%020d.json", id))
+}
+
+// writeFile atomically replaces the file at path with the JSON encoding of v.
+func writeFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return file.WriteAtomic(path, data, 0600)
+}
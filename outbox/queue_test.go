@@ -0,0 +1,90 @@
+package outbox
+
+import "testing"
+
+func TestQueue(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	var ids []int64
+
+	for _, text := range []string{"first", "second", "third"} {
+		item, err := q.Push(Item{ChatID: 1, Text: text})
+		if err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+
+		ids = append(ids, item.ID)
+	}
+
+	if !(ids[0] < ids[1] && ids[1] < ids[2]) {
+		t.Fatalf("Push() IDs %v are not growing", ids)
+	}
+
+	if err := q.Ack(ids[0]); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+
+	if err := q.Update(Item{ID: ids[1], ChatID: 1, Text: "second", Attempts: 2}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if err := q.Bury(Item{ID: ids[2], ChatID: 1, Text: "third", Attempts: 5}); err != nil {
+		t.Fatalf("Bury() error = %v", err)
+	}
+
+	pending, err := q.Pending()
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+
+	if len(pending) != 1 || pending[0].ID != ids[1] || pending[0].Attempts != 2 {
+		t.Fatalf("Pending() = %+v, want the updated second item", pending)
+	}
+
+	dead, err := q.Dead()
+	if err != nil {
+		t.Fatalf("Dead() error = %v", err)
+	}
+
+	if len(dead) != 1 || dead[0].ID != ids[2] {
+		t.Fatalf("Dead() = %+v, want the third item", dead)
+	}
+
+	n, err := q.Replay()
+	if err != nil || n != 1 {
+		t.Fatalf("Replay() = %d, %v, want 1, nil", n, err)
+	}
+
+	pending, err = q.Pending()
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+
+	if len(pending) != 2 || pending[1].ID != ids[2] || pending[1].Attempts != 0 {
+		t.Fatalf("Pending() after Replay() = %+v, want the second and the reset third item", pending)
+	}
+
+	if dead, _ := q.Dead(); len(dead) != 0 {
+		t.Errorf("Dead() after Replay() = %+v, want none", dead)
+	}
+}
+
+func TestQueueIDsGrowAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+
+	q, _ := Open(dir)
+	first, _ := q.Push(Item{ChatID: 1})
+
+	q, _ = Open(dir)
+	if _, err := q.Pending(); err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+
+	second, _ := q.Push(Item{ChatID: 1})
+	if second.ID <= first.ID {
+		t.Errorf("ID after restart %d is not greater than %d", second.ID, first.ID)
+	}
+}
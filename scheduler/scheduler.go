@@ -0,0 +1,188 @@
+// Package scheduler decides when every source is polled.
+// Each source gets its own polling interval, which may adapt to the activity of the source:
+// it shrinks while the source keeps posting threat messages and grows during quiet periods.
+// The scheduler also spreads the polls of all sources in time, so that they don't poll in lockstep.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPollInterval is the interval used for sources that don't configure one.
+	DefaultPollInterval = 10 * time.Second
+	// DefaultMinInterval is the shortest interval an adaptive source is polled at, unless configured.
+	DefaultMinInterval = 3 * time.Second
+	// DefaultMaxInterval is the longest interval an adaptive source is polled at, unless configured.
+	DefaultMaxInterval = time.Minute
+	// speedUp is the factor the interval of an adaptive source is divided by after a poll with new messages.
+	speedUp = 2
+	// slowDown is the factor the interval of an adaptive source is multiplied by after a quiet poll.
+	slowDown = 1.25
+	// jitter is the fraction of the interval by which every poll is randomly shifted.
+	jitter = 0.1
+)
+
+// Duration is a time.Duration that is encoded in JSON as a string such as "30s" or "1m".
+type Duration time.Duration
+
+// UnmarshalJSON decodes a duration from a string like "30s" or from a number of seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(time.Duration(v * float64(time.Second)))
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes the duration as a string like "30s".
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config describes how often a source is polled.
+type Config struct {
+	PollInterval time.Duration // Interval between polls; also the starting interval of an adaptive source.
+	MinInterval  time.Duration // Shortest interval of an adaptive source.
+	MaxInterval  time.Duration // Longest interval of an adaptive source.
+	Adaptive     bool          // Whether the interval adapts to the activity of the source.
+}
+
+// Scheduler coordinates the polls of all the sources.
+// It makes sure that no two polls start closer than gap to each other.
+type Scheduler struct {
+	mu   sync.Mutex
+	gap  time.Duration
+	last time.Time
+}
+
+// Schedule tracks when a single source should be polled next.
+type Schedule struct {
+	s        *Scheduler
+	cfg      Config
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// New creates a new Scheduler that keeps polls at least gap apart.
+func New(gap time.Duration) *Scheduler {
+	return &Scheduler{gap: gap}
+}
+
+// Schedule creates the schedule of a source, filling in defaults for the unset intervals.
+// The first poll happens at a random moment within the first interval to spread the sources in time.
+func (s *Scheduler) Schedule(cfg Config) *Schedule {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = min(DefaultMinInterval, cfg.PollInterval)
+	}
+	if cfg.MaxInterval <= 0 {
+		cfg.MaxInterval = max(DefaultMaxInterval, cfg.PollInterval)
+	}
+
+	return &Schedule{
+		s:        s,
+		cfg:      cfg,
+		interval: cfg.PollInterval,
+		next:     time.Now().Add(time.Duration(rand.Int63n(int64(cfg.PollInterval)))),
+	}
+}
+
+// reserve returns the earliest moment not before now that is at least gap away from the previously reserved poll.
+// It is only called for polls that are due, so a source that is delayed far into the future
+// never holds back the polls of the other sources.
+func (s *Scheduler) reserve() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at := time.Now()
+	if earliest := s.last.Add(s.gap); at.Before(earliest) {
+		at = earliest
+	}
+
+	s.last = at
+
+	return at
+}
+
+// Wait blocks until the source should be polled or the context is done.
+// It first waits for the scheduled moment and only then reserves a slot that keeps the poll
+// at least gap away from the polls of the other sources.
+func (sc *Schedule) Wait(ctx context.Context) error {
+	sc.mu.Lock()
+	next := sc.next
+	sc.mu.Unlock()
+
+	if err := sleep(ctx, time.Until(next)); err != nil {
+		return err
+	}
+
+	return sleep(ctx, time.Until(sc.s.reserve()))
+}
+
+// sleep blocks for d or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Done records the outcome of a poll and schedules the next one.
+// active tells whether the poll found new threat messages; adaptive sources poll more often
+// while they are active and less often while they are quiet.
+func (sc *Schedule) Done(active bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.cfg.Adaptive {
+		if active {
+			sc.interval /= speedUp
+		} else {
+			sc.interval = time.Duration(float64(sc.interval) * slowDown)
+		}
+
+		sc.interval = min(max(sc.interval, sc.cfg.MinInterval), sc.cfg.MaxInterval)
+	}
+
+	shift := time.Duration((rand.Float64()*2 - 1) * jitter * float64(sc.interval))
+	sc.next = time.Now().Add(sc.interval + shift)
+}
+
+// Delay postpones the next poll by at least d, e.g. after a failed fetch.
+func (sc *Schedule) Delay(d time.Duration) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if next := time.Now().Add(d); next.After(sc.next) {
+		sc.next = next
+	}
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitIgnoresDelayedSource(t *testing.T) {
+	s := New(50 * time.Millisecond)
+
+	slow := s.Schedule(Config{PollInterval: 200 * time.Millisecond})
+	fast := s.Schedule(Config{PollInterval: 200 * time.Millisecond})
+
+	slow.Delay(5 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go slow.Wait(ctx) //nolint:errcheck
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := fast.Wait(ctx); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		fast.Done(false)
+	}
+
+	// Three polls of the fast source take about 3 * 200ms; the delayed source must not add its 5s.
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fast source waited %v behind the delayed source", elapsed)
+	}
+}
+
+func TestWaitKeepsGapBetweenDuePolls(t *testing.T) {
+	const gap = 100 * time.Millisecond
+
+	s := New(gap)
+
+	var (
+		mu    sync.Mutex
+		times []time.Time
+		wg    sync.WaitGroup
+	)
+
+	for i := 0; i < 3; i++ {
+		sc := s.Schedule(Config{PollInterval: time.Millisecond})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := sc.Wait(context.Background()); err != nil {
+				t.Errorf("Wait() error = %v", err)
+				return
+			}
+
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	first, last := times[0], times[0]
+	for _, at := range times {
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+
+	// Three polls due at once are spread over at least two gaps.
+	if spread := last.Sub(first); spread < 2*gap-10*time.Millisecond {
+		t.Errorf("due polls spread over %v, want at least %v", spread, 2*gap)
+	}
+}
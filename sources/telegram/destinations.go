@@ -0,0 +1,94 @@
+package telegram
+
+import (
+	"slices"
+	"tg_alarm_bot/filter"
+	"tg_alarm_bot/templates"
+)
+
+// Destination is a chat the messages of a source are forwarded to.
+type Destination struct {
+	ChatID      int           `json:"chat_id"`               // ID of the destination chat.
+	Rule        string        `json:"rule,omitempty"`        // Name of a shared rule messages must also match to be sent to the chat; all messages if unset.
+	Silent      *bool         `json:"silent,omitempty"`      // Whether to send every message silently; decided by the severity of the threat if unset.
+	ThreadID    int           `json:"thread_id,omitempty"`   // ID of the forum topic to send messages to; the general topic if unset.
+	Retractions RetractPolicy `json:"retractions,omitempty"` // What to do with the copies of deleted posts; inherits the setting of the source if unset.
+	Template    string        `json:"template,omitempty"`    // Template of the messages sent to the chat; inherits the template of the source if unset.
+}
+
+// Subscribers defines an interface for finding the chats of the users subscribed to alerts.
+type Subscribers interface {
+	// Chats returns the IDs of the chats subscribed to a topic the text matches.
+	Chats(text string) ([]int, error)
+}
+
+// Route is a destination with the filter that decides which messages are sent to it
+// and the template the messages are rendered with.
+type Route struct {
+	Destination
+	Filter   *filter.Filter      // Filter of the destination rule, or nil if every message of the source is sent.
+	Template *templates.Template // Template of the messages, or nil for the template of the source.
+}
+
+// Targets returns the destinations of the source, including the legacy ToChannel one.
+func (s Source) Targets() []Destination {
+	if len(s.Destinations) == 0 && s.ToChannel != 0 {
+		return []Destination{{ChatID: s.ToChannel}}
+	}
+
+	return s.Destinations
+}
+
+// chats returns the IDs of the destination chats the text is sent to.
+func (s *Source) chats(text string) []int {
+	var chats []int
+
+	for _, r := range s.routes {
+		if r.Filter == nil || r.Filter.Decide(text).Accepted() {
+			chats = append(chats, r.ChatID)
+		}
+	}
+
+	return chats
+}
+
+// recipients returns the IDs of the destination chats and the subscribed chats the text is sent to.
+func (s *Source) recipients(text string) ([]int, error) {
+	chats := s.chats(text)
+	if s.subscribers == nil {
+		return chats, nil
+	}
+
+	subscribed, err := s.subscribers.Chats(text)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chatID := range subscribed {
+		if !slices.Contains(chats, chatID) {
+			chats = append(chats, chatID)
+		}
+	}
+
+	return chats, nil
+}
+
+// route returns the route to the chat, or false if the source has no route to it.
+func (s *Source) route(chatID int) (Route, bool) {
+	for _, r := range s.routes {
+		if r.ChatID == chatID {
+			return r, true
+		}
+	}
+
+	return Route{}, false
+}
+
+// retractions returns the retract policy of the chat.
+func (s *Source) retractions(chatID int) RetractPolicy {
+	if r, ok := s.route(chatID); ok && r.Retractions != "" {
+		return r.Retractions
+	}
+
+	return s.Retractions
+}
@@ -0,0 +1,186 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"tg_alarm_bot/lib/e"
+	"tg_alarm_bot/outbox"
+	"tg_alarm_bot/sources"
+	"tg_alarm_bot/storage"
+	"time"
+)
+
+// defaultEditWindow is the default time after publication during which the edits of a post are tracked.
+const defaultEditWindow = time.Hour
+
+// EditPolicy defines what happens to the forwarded copies of a post when the post is edited.
+type EditPolicy string
+
+const (
+	EditUpdate EditPolicy = "edit"   // The copies are edited to match the post.
+	EditReply  EditPolicy = "reply"  // The new text of the post is sent as a reply to the copies.
+	EditIgnore EditPolicy = "ignore" // Edits are not tracked.
+)
+
+// Valid reports whether the policy is known. An empty policy stands for EditUpdate.
+func (p EditPolicy) Valid() bool {
+	switch p {
+	case "", EditUpdate, EditReply, EditIgnore:
+		return true
+	default:
+		return false
+	}
+}
+
+// fetchChanges downloads the latest posts of the channel and returns the changes of the forwarded ones:
+// the edited posts, as messages marked as edits, followed by the deleted posts, as messages marked as deleted.
+// The latest posts are downloaded only while something was forwarded within EditWindow or RetractWindow.
+func (s *Source) fetchChanges(ctx context.Context) ([]sources.Message, error) {
+	editWindow, retractWindow := s.editWindow(), s.retractWindow()
+
+	if s.lastPost == 0 || time.Since(s.lastForwarded) > max(editWindow, retractWindow) {
+		return nil, nil
+	}
+
+	p, ok, err := s.fetchPage(ctx, "before", s.lastPost+1)
+	if err != nil || !ok || len(p.posts) == 0 {
+		return nil, err
+	}
+
+	edits, err := s.edits(p, editWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	deletions, err := s.deletions(p, retractWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(edits, deletions...), nil
+}
+
+// editWindow returns the time after publication during which the edits of a post are tracked, or 0 if they aren't.
+func (s *Source) editWindow() time.Duration {
+	switch {
+	case s.Edits == EditIgnore:
+		return 0
+	case s.EditWindow <= 0:
+		return defaultEditWindow
+	default:
+		return time.Duration(s.EditWindow)
+	}
+}
+
+// edits returns the posts of the page published within window whose text changed since they were forwarded,
+// as messages marked as edits.
+func (s *Source) edits(p page, window time.Duration) ([]sources.Message, error) {
+	var messages []sources.Message
+
+	edited := make(map[string]string)
+
+	for _, p := range p.posts {
+		if time.Since(p.Time) > window {
+			continue
+		}
+
+		forwards, err := s.store.Forwards(s.Name, p.ID)
+		if err != nil {
+			return nil, e.Wrap("can't get forwarded copies", err)
+		}
+
+		hash := textHash(p.Text)
+
+		if prev, ok := s.edited[p.ID]; ok {
+			edited[p.ID] = prev
+		}
+
+		if len(forwards) == 0 || s.edited[p.ID] == hash || !changed(forwards, hash) {
+			continue
+		}
+
+		message, _ := s.message(p, s.rules.Decide(s.matchText(p)).Hits, true)
+		message.Edit = true
+
+		messages = append(messages, message)
+		edited[p.ID] = hash
+
+		if s.Debug {
+			log.Printf("[DEBUG] %s: post %s: edited", s.Name, p.ID)
+		}
+	}
+
+	// Only the posts still on the page are remembered, so the map doesn't grow.
+	s.edited = edited
+
+	return messages, nil
+}
+
+// processEdit queues the updates of the forwarded copies of an edited post.
+// Depending on the edit policy of the source, the copies are edited or replied to with the new text.
+func (s *Source) processEdit(message sources.Message) error {
+	forwards, err := s.store.Forwards(s.Name, message.ID)
+	if err != nil {
+		return e.Wrap("can't get forwarded copies", err)
+	}
+
+	for _, f := range forwards {
+		if f.Hash == message.Hash {
+			continue
+		}
+
+		text, err := s.formatMessage(message, f.ChatID)
+		if err != nil {
+			return e.Wrap("can't format edit", err)
+		}
+
+		item := outbox.Item{
+			ChatID:    f.ChatID,
+			Text:      text,
+			Caption:   f.Caption,
+			ParseMode: "HTML",
+			Source:    s.Name,
+			PostID:    message.ID,
+			Hash:      message.Hash,
+		}
+
+		if s.Edits == EditReply {
+			if r, ok := s.route(f.ChatID); ok {
+				item.ThreadID = r.ThreadID
+			}
+
+			item.Text = "✏️ " + item.Text
+			item.ReplyTo = f.MessageID
+			item.Silent = message.Classification.Silent
+		} else {
+			item.EditMessageID = f.MessageID
+		}
+
+		if err := s.outbox.Push(item); err != nil {
+			return e.Wrap("can't queue edit", err)
+		}
+	}
+
+	return nil
+}
+
+// changed reports whether any of the forwarded copies was made from a text with a different hash.
+func changed(forwards []storage.Forward, hash string) bool {
+	for _, f := range forwards {
+		if f.Hash != hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+// textHash returns the hash of a post text used to detect edits.
+func textHash(text string) string {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
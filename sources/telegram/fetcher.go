@@ -0,0 +1,124 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// userAgent identifies the bot to t.me.
+	userAgent = "Mozilla/5.0 (compatible; tg_alarm_bot/1.0; +https://github.com/kirinyoku/tg_alarm_bot)"
+	// maxPageSize limits the size of a downloaded page.
+	maxPageSize = 10 << 20
+)
+
+// Fetcher downloads the preview pages of public Telegram channels.
+// It is shared by all the sources, so they reuse the same pool of keep-alive connections,
+// and it remembers the ETag and Last-Modified validators of the last page of every channel and pagination
+// direction to revalidate it when the same page is requested again.
+type Fetcher struct {
+	client     *http.Client
+	mu         sync.Mutex
+	validators map[string]validator
+}
+
+// validator holds the cache validators returned for the last requested URL of a channel.
+type validator struct {
+	url          string
+	etag         string
+	lastModified string
+}
+
+// NewFetcher creates a new Fetcher with an HTTP client tuned for frequent polling of t.me.
+// Responses are transparently decompressed by the transport, which asks for gzip on its own.
+func NewFetcher() *Fetcher {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &Fetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+		validators: make(map[string]validator),
+	}
+}
+
+// Get downloads the page at url. If the page has not changed since the previous request,
+// according to its ETag or Last-Modified validators, Get returns no body and notModified set to true.
+func (f *Fetcher) Get(ctx context.Context, url string) (body []byte, notModified bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	// Validators are kept per channel and direction, so the entries don't pile up as the requested posts move on.
+	key := req.URL.Host + req.URL.Path
+	for _, param := range []string{"before", "after"} {
+		if req.URL.Query().Has(param) {
+			key += "?" + param
+		}
+	}
+
+	f.mu.Lock()
+	v, ok := f.validators[key]
+	f.mu.Unlock()
+
+	if ok && v.url == url {
+		if v.etag != "" {
+			req.Header.Set("If-None-Match", v.etag)
+		}
+		if v.lastModified != "" {
+			req.Header.Set("If-Modified-Since", v.lastModified)
+		}
+	}
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, true, nil
+	default:
+		return nil, false, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	body, err = io.ReadAll(io.LimitReader(res.Body, maxPageSize))
+	if err != nil {
+		return nil, false, err
+	}
+
+	f.mu.Lock()
+	if etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified"); etag != "" || lastModified != "" {
+		f.validators[key] = validator{url: url, etag: etag, lastModified: lastModified}
+	} else {
+		delete(f.validators, key)
+	}
+	f.mu.Unlock()
+
+	return body, false, nil
+}
@@ -0,0 +1,150 @@
+package telegram
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	xhtml "golang.org/x/net/html"
+)
+
+// telegramTags maps the tags of the channel preview pages to the tags supported by the Telegram Bot API.
+var telegramTags = map[string]string{
+	"b": "b", "strong": "b",
+	"i": "i", "em": "i",
+	"u": "u", "ins": "u",
+	"s": "s", "strike": "s", "del": "s",
+	"code":       "code",
+	"pre":        "pre",
+	"blockquote": "blockquote",
+	"tg-spoiler": "tg-spoiler",
+}
+
+// formatText converts the message element of a post to the HTML subset supported by the Telegram Bot API.
+// Supported tags and absolute links are kept, other tags are dropped with their text kept, the text is
+// escaped, and line breaks become newlines. Emoji images are replaced with the emoji they stand for.
+func formatText(sel *goquery.Selection) string {
+	var b strings.Builder
+
+	for _, n := range sel.Nodes {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeNode(&b, c)
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// plainText returns the text of the message element of a post with line breaks kept as newlines.
+func plainText(sel *goquery.Selection) string {
+	var b strings.Builder
+
+	for _, n := range sel.Nodes {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writePlain(&b, c)
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// writeNode writes the node converted to Telegram HTML.
+func writeNode(b *strings.Builder, n *xhtml.Node) {
+	switch n.Type {
+	case xhtml.TextNode:
+		b.WriteString(html.EscapeString(n.Data))
+		return
+	case xhtml.ElementNode:
+	default:
+		return
+	}
+
+	if n.Data == "br" {
+		b.WriteString("\n")
+		return
+	}
+
+	open, close := "", ""
+
+	switch tag := tagOf(n); {
+	case tag == "a":
+		if href := linkOf(n); href != "" {
+			open, close = `<a href="`+html.EscapeString(href)+`">`, "</a>"
+		}
+	case tag == "emoji":
+		// Custom emoji are rendered as images with the emoji in the nested, formatted text.
+		var plain strings.Builder
+		writePlain(&plain, n)
+		b.WriteString(html.EscapeString(plain.String()))
+		return
+	case tag != "":
+		open, close = "<"+tag+">", "</"+tag+">"
+	}
+
+	b.WriteString(open)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeNode(b, c)
+	}
+	b.WriteString(close)
+}
+
+// writePlain writes the text of the node.
+func writePlain(b *strings.Builder, n *xhtml.Node) {
+	switch {
+	case n.Type == xhtml.TextNode:
+		b.WriteString(n.Data)
+	case n.Type == xhtml.ElementNode && n.Data == "br":
+		b.WriteString("\n")
+	case n.Type == xhtml.ElementNode:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writePlain(b, c)
+		}
+	}
+}
+
+// tagOf returns the Telegram tag the element is converted to: "a" for links, "emoji" for emoji images,
+// a supported formatting tag, or "" if the element is dropped.
+func tagOf(n *xhtml.Node) string {
+	classes := strings.Fields(attr(n, "class"))
+
+	for _, c := range classes {
+		switch c {
+		case "emoji":
+			return "emoji"
+		case "tg-spoiler":
+			return "tg-spoiler"
+		}
+	}
+
+	switch n.Data {
+	case "a":
+		return "a"
+	case "tg-emoji":
+		return "emoji"
+	}
+
+	return telegramTags[n.Data]
+}
+
+// linkOf returns the target of a link if it is an absolute HTTP link.
+// Relative links, such as hashtag searches on the preview page, are dropped.
+func linkOf(n *xhtml.Node) string {
+	u, err := url.Parse(attr(n, "href"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+
+	return u.String()
+}
+
+// attr returns the value of the attribute of the element.
+func attr(n *xhtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,127 @@
+package telegram
+
+import (
+	"strings"
+	"tg_alarm_bot/lib/runes"
+	"tg_alarm_bot/normalize"
+	"unicode/utf8"
+)
+
+// defaultMaxLength is the default length in runes messages must be shorter than.
+const defaultMaxLength = 150
+
+// LongPolicy defines what happens to the messages longer than the maximum length of the source.
+type LongPolicy string
+
+const (
+	LongDrop      LongPolicy = "drop"      // Long messages are dropped.
+	LongTruncate  LongPolicy = "truncate"  // Long messages are cut at the maximum length and end with an ellipsis.
+	LongSummarize LongPolicy = "summarize" // Only the sentences of long messages containing the matched keywords are kept.
+)
+
+// Valid reports whether the policy is known. An empty policy stands for LongDrop.
+func (p LongPolicy) Valid() bool {
+	switch p {
+	case "", LongDrop, LongTruncate, LongSummarize:
+		return true
+	default:
+		return false
+	}
+}
+
+// fitLength applies the length limits of the source to the cleaned text of a message.
+// The limits are checked on the raw text of the post, and the post must be shorter than MaxLength.
+// hits are the words that matched the rules, used to summarize the text.
+// The returned flag is false if the message has to be dropped.
+func (s *Source) fitLength(raw, text string, hits []string) (string, bool) {
+	n := utf8.RuneCountInString(raw)
+	if n < s.MinLength {
+		return "", false
+	}
+
+	if n < s.maxLength() {
+		return text, true
+	}
+
+	switch s.LongMessages {
+	case LongTruncate:
+		return s.truncate(text), true
+	case LongSummarize:
+		if summary := summarize(text, hits); summary != "" {
+			return s.truncate(summary), true
+		}
+
+		return s.truncate(text), true
+	default:
+		return "", false
+	}
+}
+
+// maxLength returns the maximum length of a message of the source.
+func (s *Source) maxLength() int {
+	if s.MaxLength <= 0 {
+		return defaultMaxLength
+	}
+
+	return s.MaxLength
+}
+
+// truncate cuts the text so it is shorter than the maximum length of the source.
+func (s *Source) truncate(text string) string {
+	return runes.Truncate(text, s.maxLength()-1)
+}
+
+// summarize returns the sentences of the text that contain any of the hits, joined by spaces.
+func summarize(text string, hits []string) string {
+	var words []string
+	for _, h := range hits {
+		words = append(words, normalize.Words(h)...)
+	}
+
+	var kept []string
+
+	for _, sentence := range sentences(text) {
+		if containsWord(normalize.Words(sentence), words) {
+			kept = append(kept, sentence)
+		}
+	}
+
+	return strings.Join(kept, " ")
+}
+
+// sentences splits the text into sentences ending with ".", "!", "?", "…" or a line break.
+func sentences(text string) []string {
+	var res []string
+
+	start := 0
+	for i, r := range text {
+		if r != '.' && r != '!' && r != '?' && r != '…' && r != '\n' {
+			continue
+		}
+
+		if sentence := strings.TrimSpace(text[start : i+utf8.RuneLen(r)]); sentence != "" {
+			res = append(res, sentence)
+		}
+		start = i + utf8.RuneLen(r)
+	}
+
+	if sentence := strings.TrimSpace(text[start:]); sentence != "" {
+		res = append(res, sentence)
+	}
+
+	return res
+}
+
+// containsWord reports whether any of the sentence words contains one of the words.
+// Words are compared by inclusion, since the hits of regular expressions may be parts of words.
+func containsWord(sentence, words []string) bool {
+	for _, w := range sentence {
+		for _, h := range words {
+			if strings.Contains(w, h) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFitLength(t *testing.T) {
+	short := strings.Repeat("а", defaultMaxLength-1)
+	long := strings.Repeat("а", defaultMaxLength)
+
+	tests := []struct {
+		name   string
+		source Source
+		raw    string
+		text   string
+		want   string
+		ok     bool
+	}{
+		{"shorter than the limit", Source{}, short, short, short, true},
+		{"as long as the limit", Source{}, long, long, "", false},
+		{"limit measured on the raw text", Source{}, long + " Підписатись", long[:len(short)], "", false},
+		{"too short", Source{MinLength: 10}, "Шахед", "Шахед", "", false},
+		{"configured limit", Source{MaxLength: 10}, "Шахед на Суми", "Шахед на Суми", "", false},
+		{"truncated", Source{MaxLength: 10, LongMessages: LongTruncate}, "Шахед на Суми", "Шахед на Суми", "Шахед…", true},
+		{"summarized", Source{MaxLength: 20, LongMessages: LongSummarize},
+			"Тиша. Шахед на Суми. Все.", "Тиша. Шахед на Суми. Все.", "Шахед на Суми.", true},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.source.fitLength(tt.raw, tt.text, []string{"шахед"})
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%s: fitLength() = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+
+		if ok && utf8.RuneCountInString(got) >= tt.source.maxLength() {
+			t.Errorf("%s: fitLength() = %q is not shorter than the limit", tt.name, got)
+		}
+	}
+}
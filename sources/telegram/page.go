@@ -0,0 +1,156 @@
+package telegram
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"tg_alarm_bot/sources"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// backgroundImage extracts the URL of the background image from a style attribute.
+var backgroundImage = regexp.MustCompile(`background-image:\s*url\(['"]?([^'")]+)['"]?\)`)
+
+// post is a single post parsed from a channel preview page.
+type post struct {
+	ID     string             // ID of the post in the "channel/id" form of the data-post attribute.
+	Number int                // Numeric part of the post ID.
+	Time   time.Time          // Time the post was published.
+	Text   string             // Plain text of the post.
+	HTML   string             // Text of the post with the formatting supported by the Telegram Bot API.
+	Media  []sources.Media    // Photos and videos attached to the post.
+	Reply  *reply             // Post the post replies to, if any.
+	From   string             // Name of the channel or user the post was forwarded from, if any.
+	sel    *goquery.Selection // Message element of the post.
+}
+
+// reply is the quoted parent of a reply post.
+type reply struct {
+	ID   string // ID of the parent post in the "channel/id" form, if it is known.
+	Text string // Plain text of the parent post, or a description of its media if it has no text.
+}
+
+// page is a parsed channel preview page.
+type page struct {
+	posts   []post       // Posts on the page, oldest first.
+	numbers map[int]bool // Numbers of every post on the page, including the ones that were skipped.
+	before  int          // Post ID the "load more" link to older posts points to, or 0 if there is none.
+	after   int          // Post ID the "load more" link to newer posts points to, or 0 if there is none.
+}
+
+// parsePage parses the HTML content of a channel preview page.
+// Posts without a valid timestamp are skipped, but their numbers are still recorded.
+func parsePage(r io.Reader) (page, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return page{}, err
+	}
+
+	p := page{numbers: make(map[int]bool)}
+
+	// Find and iterate over message elements in the HTML document.
+	doc.Find(".tgme_widget_message").Each(func(i int, sel *goquery.Selection) {
+		messageID, _ := sel.Attr("data-post")
+		if n := postNumber(messageID); n > 0 {
+			p.numbers[n] = true
+		}
+
+		// The quoted parent of a reply has the same class as the text of the post itself.
+		textSel := sel.Find(".tgme_widget_message_text").Not(".tgme_widget_message_reply .tgme_widget_message_text").First()
+
+		// Extract and parse the message timestamp, skipping the message if it is invalid.
+		postTime, _ := sel.Find(".tgme_widget_message_date time").Attr("datetime")
+		parsedTime, err := time.Parse(time.RFC3339, postTime)
+		if err != nil {
+			return
+		}
+
+		p.posts = append(p.posts, post{
+			ID:     messageID,
+			Number: postNumber(messageID),
+			Time:   parsedTime,
+			Text:   plainText(textSel),
+			HTML:   formatText(textSel),
+			Media:  parseMedia(sel),
+			Reply:  parseReply(sel),
+			From:   strings.TrimSpace(sel.Find(".tgme_widget_message_forwarded_from_name").First().Text()),
+			sel:    sel,
+		})
+	})
+
+	// The "load more" links carry the post ID to continue from in their data attributes.
+	if v, ok := doc.Find(".js-messages_more[data-before]").Attr("data-before"); ok {
+		p.before, _ = strconv.Atoi(v)
+	}
+
+	if v, ok := doc.Find(".js-messages_more[data-after]").Attr("data-after"); ok {
+		p.after, _ = strconv.Atoi(v)
+	}
+
+	sort.Slice(p.posts, func(i, j int) bool { return p.posts[i].Number < p.posts[j].Number })
+
+	return p, nil
+}
+
+// parseReply extracts the quoted parent of a reply post, or returns nil if the post is not a reply.
+func parseReply(sel *goquery.Selection) *reply {
+	block := sel.Find(".tgme_widget_message_reply").First()
+	if block.Length() == 0 {
+		return nil
+	}
+
+	r := &reply{Text: plainText(block.Find(".tgme_widget_message_text").First())}
+
+	// Parents without text, e.g. photos, are described by the meta text instead.
+	if r.Text == "" {
+		r.Text = strings.TrimSpace(block.Find(".tgme_widget_message_metatext").First().Text())
+	}
+
+	if href, ok := block.Attr("href"); ok {
+		if u, err := url.Parse(href); err == nil && postNumber(u.Path) > 0 {
+			r.ID = strings.TrimPrefix(u.Path, "/")
+		}
+	}
+
+	return r
+}
+
+// parseMedia extracts the photos and videos of a post, in the order they appear.
+// Photos are shown as background images of their links, and videos have their file in the src attribute;
+// videos too large to be played on the page have no file and are skipped. Preview pages don't expose the files
+// of documents, so documents can't be extracted.
+func parseMedia(sel *goquery.Selection) []sources.Media {
+	var media []sources.Media
+
+	sel.Find(".tgme_widget_message_photo_wrap, video.tgme_widget_message_video").Each(func(i int, m *goquery.Selection) {
+		if goquery.NodeName(m) == "video" {
+			if src, ok := m.Attr("src"); ok && src != "" {
+				media = append(media, sources.Media{Type: sources.MediaVideo, URL: src})
+			}
+
+			return
+		}
+
+		style, _ := m.Attr("style")
+		if match := backgroundImage.FindStringSubmatch(style); match != nil {
+			media = append(media, sources.Media{Type: sources.MediaPhoto, URL: match[1]})
+		}
+	})
+
+	return media
+}
+
+// oldest returns the oldest post on the page. The page must not be empty.
+func (p page) oldest() post {
+	return p.posts[0]
+}
+
+// newest returns the newest post on the page. The page must not be empty.
+func (p page) newest() post {
+	return p.posts[len(p.posts)-1]
+}
@@ -0,0 +1,150 @@
+package telegram
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"tg_alarm_bot/sources"
+	"time"
+)
+
+func TestParsePage(t *testing.T) {
+	p := mustParsePage(t, "testdata/channel.html")
+
+	if p.before != 41200 || p.after != 41203 {
+		t.Errorf("load more cursors = %d, %d, want 41200, 41203", p.before, p.after)
+	}
+
+	// The post without a date is skipped, but its number is still known.
+	if len(p.posts) != 3 {
+		t.Fatalf("parsed %d posts, want 3", len(p.posts))
+	}
+
+	if len(p.numbers) != 4 || !p.numbers[41204] {
+		t.Errorf("numbers = %v, want 41201-41204", p.numbers)
+	}
+
+	tests := []struct {
+		id    string
+		time  time.Time
+		text  string
+		html  string
+		media []sources.Media
+		reply *reply
+		from  string
+	}{
+		{
+			id:   "sumyregion/41201",
+			time: time.Date(2024, 10, 1, 9, 15, 2, 0, time.UTC),
+			text: "⚠️ Увага! Шахед курсом на Суми & Сумщину\n\n#Суми | Підписатись",
+			html: `⚠️ <b>Увага!</b> Шахед курсом на <i>Суми</i> &amp; <u>Сумщину</u>` + "\n\n" +
+				`#Суми | <a href="https://t.me/sumyregion">Підписатись</a>`,
+		},
+		{
+			id:    "sumyregion/41202",
+			time:  time.Date(2024, 10, 1, 9, 21, 40, 0, time.UTC),
+			text:  "Збито двома ракетами, загроза x-101",
+			html:  `Збито <tg-spoiler>двома</tg-spoiler> ракетами, <s>загроза</s> <code>x-101</code>`,
+			reply: &reply{ID: "sumyregion/41201", Text: "⚠️ Увага! Шахед курсом на Суми & Сумщину"},
+		},
+		{
+			id:   "sumyregion/41203",
+			time: time.Date(2024, 10, 1, 10, 2, 11, 0, time.UTC),
+			text: "Наслідки удару по місту детальніше",
+			html: `Наслідки удару по місту <a href="https://example.com/news?id=1&amp;lang=uk">детальніше</a>`,
+			media: []sources.Media{
+				{Type: sources.MediaPhoto, URL: "https://cdn4.cdn-telegram.org/file/photo-one.jpg"},
+				{Type: sources.MediaVideo, URL: "https://cdn4.cdn-telegram.org/file/video-one.mp4?token=abc"},
+			},
+			from: "RDS-prostir",
+		},
+	}
+
+	for i, tt := range tests {
+		got := p.posts[i]
+
+		if got.ID != tt.id || got.Number != postNumber(tt.id) {
+			t.Errorf("post %d: ID = %q (%d), want %q", i, got.ID, got.Number, tt.id)
+			continue
+		}
+
+		if !got.Time.Equal(tt.time) {
+			t.Errorf("%s: Time = %v, want %v", tt.id, got.Time, tt.time)
+		}
+
+		if got.Text != tt.text {
+			t.Errorf("%s: Text = %q, want %q", tt.id, got.Text, tt.text)
+		}
+
+		if got.HTML != tt.html {
+			t.Errorf("%s: HTML = %q, want %q", tt.id, got.HTML, tt.html)
+		}
+
+		if !reflect.DeepEqual(got.Media, tt.media) {
+			t.Errorf("%s: Media = %+v, want %+v", tt.id, got.Media, tt.media)
+		}
+
+		if !reflect.DeepEqual(got.Reply, tt.reply) {
+			t.Errorf("%s: Reply = %+v, want %+v", tt.id, got.Reply, tt.reply)
+		}
+
+		if got.From != tt.from {
+			t.Errorf("%s: From = %q, want %q", tt.id, got.From, tt.from)
+		}
+	}
+}
+
+func TestParseLastPage(t *testing.T) {
+	p := mustParsePage(t, "testdata/last_page.html")
+
+	if p.before != 0 || p.after != 0 {
+		t.Errorf("load more cursors = %d, %d, want none", p.before, p.after)
+	}
+
+	if len(p.posts) != 2 {
+		t.Fatalf("parsed %d posts, want 2", len(p.posts))
+	}
+
+	// Posts are sorted oldest first.
+	if p.oldest().Number != 3049 || p.newest().Number != 3051 {
+		t.Errorf("oldest, newest = %d, %d, want 3049, 3051", p.oldest().Number, p.newest().Number)
+	}
+
+	custom := p.oldest()
+	if want := "🚀 Ракетна небезпека <область>"; custom.Text != want {
+		t.Errorf("Text = %q, want %q", custom.Text, want)
+	}
+
+	if want := "🚀 Ракетна небезпека &lt;область&gt;"; custom.HTML != want {
+		t.Errorf("HTML = %q, want %q", custom.HTML, want)
+	}
+
+	// A reply to a photo is described by the meta text of the quote.
+	replied := p.newest()
+	if want := (&reply{ID: "glukhovalarm/3050", Text: "Photo"}); !reflect.DeepEqual(replied.Reply, want) {
+		t.Errorf("Reply = %+v, want %+v", replied.Reply, want)
+	}
+
+	if want := "Уважно!\nМопед над <b>Глуховом</b>"; replied.HTML != want {
+		t.Errorf("HTML = %q, want %q", replied.HTML, want)
+	}
+}
+
+// mustParsePage parses the saved channel page at path.
+func mustParsePage(t *testing.T, path string) page {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	p, err := parsePage(f)
+	if err != nil {
+		t.Fatalf("parsePage() error = %v", err)
+	}
+
+	return p
+}
@@ -0,0 +1,37 @@
+package telegram
+
+// MatchScope defines which text of a reply post the rules are matched against.
+type MatchScope string
+
+const (
+	MatchPost  MatchScope = "post"  // The own text of the post.
+	MatchQuote MatchScope = "quote" // The text of the quoted parent of the post.
+	MatchBoth  MatchScope = "both"  // The own text of the post followed by the quoted text.
+)
+
+// Valid reports whether the scope is known. An empty scope stands for MatchPost.
+func (m MatchScope) Valid() bool {
+	switch m {
+	case "", MatchPost, MatchQuote, MatchBoth:
+		return true
+	default:
+		return false
+	}
+}
+
+// matchText returns the text of the post the rules and the classifier are applied to, according to MatchOn.
+// For posts that are not replies, it is always the own text of the post.
+func (s *Source) matchText(p post) string {
+	if p.Reply == nil {
+		return p.Text
+	}
+
+	switch s.MatchOn {
+	case MatchQuote:
+		return p.Reply.Text
+	case MatchBoth:
+		return p.Text + "\n" + p.Reply.Text
+	default:
+		return p.Text
+	}
+}
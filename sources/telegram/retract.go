@@ -0,0 +1,164 @@
+package telegram
+
+import (
+	"html"
+	"log"
+	"strings"
+	tg_client "tg_alarm_bot/client/telegram"
+	"tg_alarm_bot/lib/e"
+	"tg_alarm_bot/lib/runes"
+	"tg_alarm_bot/outbox"
+	"tg_alarm_bot/sources"
+	"tg_alarm_bot/storage"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// defaultRetractWindow is the default time after forwarding during which the deletion of a post is tracked.
+const defaultRetractWindow = time.Hour
+
+// retractedMark precedes the text of the forwarded copies of deleted posts.
+const retractedMark = "❌ <b>Відкликано джерелом</b>\n\n"
+
+// RetractPolicy defines what happens to the forwarded copies of a post when the post is deleted.
+type RetractPolicy string
+
+const (
+	RetractMark   RetractPolicy = "mark"   // The copies are edited to start with a "retracted by source" mark.
+	RetractDelete RetractPolicy = "delete" // The copies are deleted.
+	RetractIgnore RetractPolicy = "ignore" // Deletions are not tracked.
+)
+
+// Valid reports whether the policy is known. An empty policy stands for RetractMark.
+func (p RetractPolicy) Valid() bool {
+	switch p {
+	case "", RetractMark, RetractDelete, RetractIgnore:
+		return true
+	default:
+		return false
+	}
+}
+
+// retractWindow returns the time after forwarding during which the deletion of a post is tracked, or 0 if it isn't.
+func (s *Source) retractWindow() time.Duration {
+	switch {
+	case s.Retractions == RetractIgnore:
+		return 0
+	case s.RetractWindow <= 0:
+		return defaultRetractWindow
+	default:
+		return time.Duration(s.RetractWindow)
+	}
+}
+
+// deletions returns the posts forwarded within window that are missing from the page, as messages marked as deleted.
+// Post numbers grow without reuse, so a forwarded post numbered between the oldest and the newest post of the page
+// but absent from it has been deleted. Posts outside of the page can't be checked, and posts that are on the page
+// but couldn't be parsed are not deleted.
+func (s *Source) deletions(p page, window time.Duration) ([]sources.Message, error) {
+	if window == 0 {
+		return nil, nil
+	}
+
+	ids, err := s.store.ForwardedPosts(s.Name)
+	if err != nil {
+		return nil, e.Wrap("can't get forwarded posts", err)
+	}
+
+	var messages []sources.Message
+
+	for _, id := range ids {
+		n := postNumber(id)
+		if n < p.oldest().Number || n > p.newest().Number || p.numbers[n] {
+			continue
+		}
+
+		forwards, err := s.store.Forwards(s.Name, id)
+		if err != nil {
+			return nil, e.Wrap("can't get forwarded copies", err)
+		}
+
+		recent := false
+		for _, f := range forwards {
+			recent = recent || time.Since(f.Time) <= window
+		}
+
+		if !recent {
+			continue
+		}
+
+		messages = append(messages, sources.Message{ID: id, Deleted: true})
+
+		if s.Debug {
+			log.Printf("[DEBUG] %s: post %s: deleted", s.Name, id)
+		}
+	}
+
+	return messages, nil
+}
+
+// processDeletion queues the retraction of the forwarded copies of a deleted post and stops tracking them.
+// Depending on the retract policy of the destination, the copies are deleted or marked as retracted.
+func (s *Source) processDeletion(message sources.Message) error {
+	forwards, err := s.store.Forwards(s.Name, message.ID)
+	if err != nil {
+		return e.Wrap("can't get forwarded copies", err)
+	}
+
+	for _, f := range forwards {
+		policy := s.retractions(f.ChatID)
+		if policy == RetractIgnore {
+			continue
+		}
+
+		item := outbox.Item{
+			ChatID:        f.ChatID,
+			EditMessageID: f.MessageID,
+			Caption:       f.Caption,
+			Retracted:     true,
+			Source:        s.Name,
+			PostID:        message.ID,
+		}
+
+		if policy == RetractDelete {
+			item.Delete = true
+		} else {
+			item.Text = retraction(f)
+			item.ParseMode = "HTML"
+		}
+
+		if err := s.outbox.Push(item); err != nil {
+			return e.Wrap("can't queue retraction", err)
+		}
+	}
+
+	if err := s.store.DeleteForwards(s.Name, message.ID); err != nil {
+		return e.Wrap("can't delete forwarded copies", err)
+	}
+
+	return nil
+}
+
+// retraction returns the text of the forwarded copy marked as retracted. If the mark doesn't fit in the limit
+// of a message or a caption along with the text, the plain text of the copy is shortened, so no tag is cut.
+func retraction(f storage.Forward) string {
+	limit := tg_client.MaxMessageLength
+	if f.Caption {
+		limit = tg_client.MaxCaptionLength
+	}
+
+	text := retractedMark + f.Text
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	plain := f.Text
+	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(f.Text)); err == nil {
+		plain = doc.Text()
+	}
+
+	// Escaping only adds markup, which doesn't count towards the limit.
+	return retractedMark + html.EscapeString(runes.Truncate(plain, limit-utf8.RuneCountInString(retractedMark)))
+}
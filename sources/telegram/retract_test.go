@@ -0,0 +1,53 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+	tg_client "tg_alarm_bot/client/telegram"
+	"tg_alarm_bot/storage"
+	"time"
+	"unicode/utf8"
+)
+
+func TestDeletions(t *testing.T) {
+	s := newTestSource(t)
+
+	for _, id := range []string{"test/9", "test/11", "test/13", "test/15"} {
+		if err := s.store.SaveForward(s.Name, id, storage.Forward{ChatID: -100, MessageID: 1, Time: time.Now()}); err != nil {
+			t.Fatalf("SaveForward() error = %v", err)
+		}
+	}
+
+	// Post 11 is on the page but couldn't be parsed, post 13 is gone, and posts 9 and 15 are outside of the page.
+	p := page{
+		posts:   []post{{ID: "test/10", Number: 10}, {ID: "test/12", Number: 12}, {ID: "test/14", Number: 14}},
+		numbers: map[int]bool{10: true, 11: true, 12: true, 14: true},
+	}
+
+	messages, err := s.deletions(p, time.Hour)
+	if err != nil {
+		t.Fatalf("deletions() error = %v", err)
+	}
+
+	if len(messages) != 1 || messages[0].ID != "test/13" || !messages[0].Deleted {
+		t.Errorf("deletions() = %+v, want only test/13 deleted", messages)
+	}
+}
+
+func TestRetraction(t *testing.T) {
+	short := storage.Forward{Text: "<b>Шахед</b> на Суми"}
+	if got, want := retraction(short), retractedMark+short.Text; got != want {
+		t.Errorf("retraction() = %q, want %q", got, want)
+	}
+
+	long := storage.Forward{Text: "<b>Шахед</b> " + strings.Repeat("на Суми ", 200), Caption: true}
+
+	got := retraction(long)
+	if n := utf8.RuneCountInString(got); n > tg_client.MaxCaptionLength {
+		t.Errorf("retraction() is %d runes long, want at most %d", n, tg_client.MaxCaptionLength)
+	}
+
+	if !strings.HasPrefix(got, retractedMark+"Шахед на Суми") || !strings.HasSuffix(got, "…") {
+		t.Errorf("retraction() = %q, want the shortened plain text after the mark", got)
+	}
+}
@@ -1,133 +1,465 @@
 // Package telegram provides functionality for fetching and processing messages from public Telegram channels.
 // It includes tools to filter messages based on specific patterns, clean up unwanted content, and forward the
-// filtered messages to a designated Telegram channel via a Telegram client.
+// filtered messages to a designated Telegram channel via the outbox.
 package telegram
 
 import (
-	"fmt"
-	"io"
-	"net/http"
-	"regexp"
+	"bytes"
+	"context"
+	"html"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
-	"tg_alarm_bot/client/telegram"
+	"tg_alarm_bot/classifier"
+	"tg_alarm_bot/filter"
 	"tg_alarm_bot/lib/e"
+	"tg_alarm_bot/outbox"
+	"tg_alarm_bot/scheduler"
 	"tg_alarm_bot/sources"
+	"tg_alarm_bot/storage"
+	"tg_alarm_bot/templates"
 	"time"
-	"unicode/utf8"
+)
 
-	"github.com/PuerkitoBio/goquery"
+const (
+	// defaultBackfillPages is the default maximum number of pages fetched at once to catch up on missed posts.
+	defaultBackfillPages = 10
+	// defaultBackfillAge is the default maximum age of missed posts to catch up on.
+	defaultBackfillAge = 6 * time.Hour
 )
 
 // Source represents a Telegram source that fetches and processes messages.
 // It includes configuration for fetching, filtering, and sending messages to a specific Telegram channel.
 type Source struct {
-	Name            string               `json:"name"`              // Name of the source.
-	URL             string               `json:"url"`               // URL of the Telegram public channel.
-	SearchRegexp    string               `json:"search_regexp"`     // Regular expression to search for specific patterns in messages.
-	PhrasesToRemove []string             `json:"phrases_to_remove"` // List of phrases to remove from the messages before sending.
-	ToChannel       int                  `json:"to_channel"`        // ID of the destination Telegram channel to forward messages to.
-	seen            map[string]time.Time `json:"-"`                 // Map of seen messages with their timestamp to avoid duplicates.
-	expiry          time.Duration        `json:"-"`                 // Expiry duration for messages to be considered 'seen'.
-	tg              *telegram.Client     `json:"-"`                 // Telegram client to send messages.
-	startTime       time.Time            `json:"-"`                 // Time when the source started, used to filter old messages.
-}
-
-// New creates a new Source instance with the provided parameters.
-// It initializes the seen map and sets the expiry duration to 24 hours by default.
-func New(name string, url string, pattern string, phrases []string, to int, tg *telegram.Client) *Source {
-	return &Source{
-		Name:            name,
-		URL:             url,
-		SearchRegexp:    pattern,
-		PhrasesToRemove: phrases,
-		ToChannel:       to,
-		seen:            make(map[string]time.Time),
-		expiry:          24 * time.Hour,
-		tg:              tg,
-		startTime:       time.Now(),
-	}
+	Name            string                 `json:"name"`                        // Name of the source.
+	URL             string                 `json:"url"`                         // URL of the Telegram public channel.
+	SearchRegexp    string                 `json:"search_regexp,omitempty"`     // Legacy regular expression to search for alerts, used if no rule is set.
+	Rule            string                 `json:"rule,omitempty"`              // Name of the shared rule that decides which messages are alerts.
+	ExcludeRegexp   []string               `json:"exclude_regexp,omitempty"`    // Regular expressions of messages to drop, in addition to the global ones.
+	ExcludeKeywords []string               `json:"exclude_keywords,omitempty"`  // Keywords of messages to drop, in addition to the global ones.
+	NegationCheck   *bool                  `json:"negation_check,omitempty"`    // Whether to drop all-clear and negated messages; inherits the global setting if unset.
+	Debug           bool                   `json:"debug,omitempty"`             // Whether to log the filter decision for every new post.
+	Paused          bool                   `json:"paused,omitempty"`            // Whether the channel is not polled until it is resumed by an admin.
+	PhrasesToRemove []string               `json:"phrases_to_remove,omitempty"` // List of phrases to remove from the messages before sending.
+	ToChannel       int                    `json:"to_channel,omitempty"`        // Legacy ID of the single destination channel, used if no destinations are set.
+	Destinations    []Destination          `json:"destinations,omitempty"`      // Chats to forward messages to.
+	Template        string                 `json:"template,omitempty"`          // Template of the forwarded messages; the default one if unset.
+	PollInterval    scheduler.Duration     `json:"poll_interval,omitempty"`     // Interval between polls of the channel.
+	MinInterval     scheduler.Duration     `json:"min_interval,omitempty"`      // Shortest polling interval in the adaptive mode.
+	MaxInterval     scheduler.Duration     `json:"max_interval,omitempty"`      // Longest polling interval in the adaptive mode.
+	Adaptive        bool                   `json:"adaptive,omitempty"`          // Whether to poll more often while the channel posts threat messages.
+	BackfillPages   int                    `json:"backfill_pages,omitempty"`    // Maximum number of pages fetched at once to catch up on missed posts.
+	BackfillAge     scheduler.Duration     `json:"backfill_age,omitempty"`      // Maximum age of missed posts to catch up on.
+	MinLength       int                    `json:"min_length,omitempty"`        // Minimum length of a message in runes; shorter messages are dropped.
+	MaxLength       int                    `json:"max_length,omitempty"`        // Length in runes posts must be shorter than; 150 if unset.
+	LongMessages    LongPolicy             `json:"long_messages,omitempty"`     // What to do with posts not shorter than MaxLength; dropped if unset.
+	Edits           EditPolicy             `json:"edits,omitempty"`             // What to do with the forwarded copies of edited posts; edited if unset.
+	EditWindow      scheduler.Duration     `json:"edit_window,omitempty"`       // Time after publication during which the edits of a post are tracked; 1h if unset.
+	MatchOn         MatchScope             `json:"match_on,omitempty"`          // Which text of reply posts the rules are matched against; the post's own if unset.
+	Retractions     RetractPolicy          `json:"retractions,omitempty"`       // What to do with the forwarded copies of deleted posts; marked if unset.
+	RetractWindow   scheduler.Duration     `json:"retract_window,omitempty"`    // Time after forwarding during which the deletion of a post is tracked; 1h if unset.
+	rules           *filter.Filter         `json:"-"`                           // Filter that decides which messages are alerts.
+	routes          []Route                `json:"-"`                           // Destinations with their filters and templates.
+	subscribers     Subscribers            `json:"-"`                           // Chats of the users subscribed to the alerts, or nil.
+	template        *templates.Template    `json:"-"`                           // Compiled Template, used for chats without a template of their own.
+	classifier      *classifier.Classifier `json:"-"`                           // Classifier that tags alerts with the type of the threat.
+	store           storage.Store          `json:"-"`                           // Store of seen and forwarded messages used to avoid duplicates across restarts.
+	expiry          time.Duration          `json:"-"`                           // Expiry duration for messages to be considered 'seen'.
+	outbox          *outbox.Outbox         `json:"-"`                           // Outbox to deliver messages through.
+	fetcher         *Fetcher               `json:"-"`                           // Fetcher to download the channel pages with.
+	lastPost        int                    `json:"-"`                           // Numeric ID of the newest post seen on the channel page.
+	startTime       time.Time              `json:"-"`                           // Time when the source started, used to filter old messages on the first run.
+	lastForwarded   time.Time              `json:"-"`                           // Time a message was last forwarded, or the start time; changes are tracked for a while after it.
+	edited          map[string]string      `json:"-"`                           // Text hashes of the posts whose edits have been queued.
+}
+
+// New creates a new Source instance from the configuration of the source.
+// It uses the filter to select alerts, the classifier to tag them, the routes and the subscribers to pick
+// their destinations, the template compiled from the configuration to render messages to chats without
+// a template of their own, the store to keep track of seen and forwarded messages and sets the expiry duration
+// to 24 hours by default. subscribers may be nil.
+func New(cfg Source, rules *filter.Filter, cl *classifier.Classifier, routes []Route, tmpl *templates.Template, subscribers Subscribers, out *outbox.Outbox, store storage.Store, fetcher *Fetcher) *Source {
+	s := cfg
+
+	s.rules = rules
+	s.classifier = cl
+	s.routes = routes
+	s.subscribers = subscribers
+	s.store = store
+	s.expiry = 24 * time.Hour
+	s.outbox = out
+	s.fetcher = fetcher
+	s.startTime = time.Now()
+	s.lastForwarded = time.Now()
+	s.template = tmpl
+
+	return &s
 }
 
 // Fetch retrieves and filters messages from the Telegram source URL.
-// It uses an HTTP GET request to fetch the data and filters the messages based on the search regular expression.
-// Old messages in the 'seen' map that exceed the expiry time are deleted.
-func (s *Source) Fetch() ([]sources.Message, error) {
-	res, err := http.Get(s.URL)
+// It downloads the posts newer than the newest one seen so far, including the ones that didn't fit
+// on a single page, and filters them with the filter of the source. Recently forwarded posts are
+// checked for edits and deletions, which are returned after the new messages.
+// Seen messages that exceed the expiry time are pruned from the store.
+// Failures to check for changes or to prune the store are only logged, so the new messages are never lost.
+func (s *Source) Fetch(ctx context.Context) ([]sources.Message, error) {
+	posts, err := s.fetchPosts(ctx)
 	if err != nil {
 		return nil, e.Wrap("can't fetch data from telegram source", err)
 	}
 
-	defer res.Body.Close()
-
-	messages, err := s.filter(res.Body)
+	messages, err := s.filter(posts)
 	if err != nil {
 		return nil, e.Wrap("can't fetch data from telegram source", err)
 	}
 
-	for id, timestamp := range s.seen {
-		if time.Since(timestamp) > s.expiry {
-			delete(s.seen, id)
-		}
+	// The new posts are not downloaded again, so their messages are returned even if the rest fails.
+	changes, err := s.fetchChanges(ctx)
+	if err != nil {
+		log.Printf("%s: can't fetch changes from telegram source: %s", s.Name, err)
+	}
+
+	messages = append(messages, changes...)
+
+	if err := s.store.Prune(s.Name, s.expiry); err != nil {
+		log.Printf("%s: can't prune seen messages: %s", s.Name, err)
 	}
 
 	return messages, nil
 }
 
-// Process sends a given message to the configured Telegram channel using the Telegram client.
-// It forwards the message text to the target channel.
-func (s *Source) Process(message sources.Message) error {
-	return s.tg.SendMessage(
-		s.ToChannel,
-		message.Text,
-		"HTML",
-	)
-}
+// fetchPosts downloads the posts published after the newest one seen so far, oldest first.
+// Before the first fetch, the posts following the last processed one are requested, so the posts
+// published while the bot was down are caught up on. If the requested page doesn't reach back to
+// or forward from the known posts, the "load more" pagination is followed in the missing direction,
+// up to BackfillPages pages and BackfillAge back in time. Posts older than BackfillAge are not
+// paginated through forward either: the latest page is requested instead.
+func (s *Source) fetchPosts(ctx context.Context) ([]post, error) {
+	if s.lastPost == 0 {
+		lastID, err := s.store.LastPostID(s.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		s.lastPost = lastID
+	}
+
+	known := s.lastPost
+
+	first, ok, err := s.fetchPage(ctx, "after", known)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	pages := 1
+	maxPages, maxAge := s.backfillLimits()
+
+	// If even the newest of the posts following the known one is too old to catch up on,
+	// the rest of the gap is filled back from the latest posts instead.
+	if known > 0 && len(first.posts) > 0 && time.Since(first.newest().Time) > maxAge {
+		if first, ok, err = s.fetchPage(ctx, "after", 0); err != nil || !ok {
+			return nil, err
+		}
+
+		pages++
+	}
+
+	posts := first.posts
+
+	// Follow the pagination to newer posts if the burst didn't fit on the first page.
+	for p := first; p.after > 0 && len(p.posts) > 0 && pages < maxPages; pages++ {
+		if p, ok, err = s.fetchPage(ctx, "after", p.newest().Number); err != nil || !ok {
+			break
+		}
+
+		posts = append(posts, p.posts...)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Follow the pagination to older posts until the gap to the known posts is filled.
+	for p := first; known > 0 && p.before > 0 && len(p.posts) > 0 && pages < maxPages; pages++ {
+		if p.oldest().Number <= known+1 || time.Since(p.oldest().Time) > maxAge {
+			break
+		}
+
+		if p, ok, err = s.fetchPage(ctx, "before", p.oldest().Number); err != nil || !ok {
+			break
+		}
+
+		posts = append(p.posts, posts...)
+	}
 
-// filter parses the HTML content of the Telegram page and extracts messages matching the search pattern.
-// It uses goquery to select and process message elements and returns a list of matching messages.
-func (s *Source) filter(r io.Reader) ([]sources.Message, error) {
-	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
 		return nil, err
 	}
 
+	if pages > 1 {
+		log.Printf("%s: fetched %d pages to catch up from post %d", s.Name, pages, known)
+	}
+
+	return uniquePosts(posts), nil
+}
+
+// fetchPage downloads and parses the channel page with the posts before or after the given post ID.
+// If id is 0, the latest posts are requested. The returned flag is false if the page has not changed
+// since it was requested last time.
+func (s *Source) fetchPage(ctx context.Context, direction string, id int) (page, bool, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return page{}, false, err
+	}
+
+	if id > 0 {
+		q := u.Query()
+		q.Set(direction, strconv.Itoa(id))
+		u.RawQuery = q.Encode()
+	}
+
+	body, notModified, err := s.fetcher.Get(ctx, u.String())
+	if err != nil || notModified {
+		return page{}, false, err
+	}
+
+	p, err := parsePage(bytes.NewReader(body))
+	if err != nil {
+		return page{}, false, err
+	}
+
+	for _, post := range p.posts {
+		if post.Number > s.lastPost {
+			s.lastPost = post.Number
+		}
+	}
+
+	return p, true, nil
+}
+
+// backfillLimits returns the maximum number of pages and the maximum age of posts to fetch when catching up.
+func (s *Source) backfillLimits() (int, time.Duration) {
+	pages, age := s.BackfillPages, time.Duration(s.BackfillAge)
+	if pages <= 0 {
+		pages = defaultBackfillPages
+	}
+	if age <= 0 {
+		age = defaultBackfillAge
+	}
+
+	return pages, age
+}
+
+// Process queues a given message for delivery to each of its destination chats.
+// It renders the message with the template of the destination, attaches the media of the post,
+// which then carry the text as their caption, pushes it to the outbox and, once it is queued for every chat,
+// marks the post as seen and records it as processed. If queueing fails, the post is downloaded again
+// on the next fetch, so the message is retried. Low severity messages are delivered silently,
+// unless the destination says otherwise. Chats without a route, i.e. the private chats of subscribers,
+// get the default template.
+func (s *Source) Process(ctx context.Context, message sources.Message) error {
+	switch {
+	case message.Edit:
+		return s.processEdit(message)
+	case message.Deleted:
+		return s.processDeletion(message)
+	}
+
+	media := make([]outbox.Media, len(message.Media))
+	for i, m := range message.Media {
+		media[i] = outbox.Media{Type: m.Type, URL: m.URL}
+	}
+
+	for _, chatID := range message.Chats {
+		r, ok := s.route(chatID)
+		if !ok {
+			r = Route{Destination: Destination{ChatID: chatID}}
+		}
+
+		silent := message.Classification.Silent
+		if r.Silent != nil {
+			silent = *r.Silent
+		}
+
+		text, err := s.formatMessage(message, chatID)
+		if err != nil {
+			return e.Wrap("can't format message", err)
+		}
+
+		err = s.outbox.Push(outbox.Item{
+			ChatID:    r.ChatID,
+			ThreadID:  r.ThreadID,
+			Text:      text,
+			Media:     media,
+			ParseMode: "HTML",
+			Silent:    silent,
+			Source:    s.Name,
+			PostID:    message.ID,
+			Hash:      message.Hash,
+		})
+		if err != nil {
+			s.retry(message)
+			return e.Wrap("can't queue message", err)
+		}
+	}
+
+	s.lastForwarded = time.Now()
+
+	if err := s.store.MarkSeen(s.Name, message.ID); err != nil {
+		return e.Wrap("can't mark message as seen", err)
+	}
+
+	// The post is processed only if no earlier post of the batch is waiting for a retry.
+	if n := postNumber(message.ID); n <= s.lastPost {
+		if err := s.store.SetLastPostID(s.Name, n); err != nil {
+			return e.Wrap("can't save last processed post", err)
+		}
+	}
+
+	return nil
+}
+
+// retry makes the next fetch download the post of the message again, so the message is processed anew.
+// The chats it was queued for before the failure get it again.
+func (s *Source) retry(message sources.Message) {
+	if n := postNumber(message.ID); n > 0 && n <= s.lastPost {
+		s.lastPost = n - 1
+	}
+}
+
+// filter extracts the posts accepted by the filter of the source and returns them as messages.
+// Posts up to the last processed one are skipped, and so are the posts older than BackfillAge;
+// if nothing has been processed yet, posts published before the source started are skipped instead.
+// The posts preceding the first returned message are recorded as processed; the rest are recorded
+// by Process once their messages are queued.
+func (s *Source) filter(posts []post) ([]sources.Message, error) {
+	lastID, err := s.store.LastPostID(s.Name)
+	if err != nil {
+		return nil, e.Wrap("can't get last processed post", err)
+	}
+
+	_, maxAge := s.backfillLimits()
+
+	oldest := time.Now().Add(-maxAge)
+	if lastID == 0 {
+		oldest = s.startTime
+	}
+
 	var messages []sources.Message
 
-	// Find and iterate over message elements in the HTML document.
-	doc.Find(".tgme_widget_message").Each(func(i int, sel *goquery.Selection) {
-		messageID, _ := sel.Attr("data-post")
-		messageText := sel.Find(".tgme_widget_message_text").First().Text()
-
-		// If the message has a reply, extract the text from the reply block.
-		if replyBlock := sel.Find(".tgme_widget_message_reply"); replyBlock.Length() > 0 {
-			messageText = replyBlock.Next().Find(".tgme_widget_message_text").Text()
-		}
-
-		// Extract and parse the message timestamp.
-		postTime, _ := sel.Find(".tgme_widget_message_date time").Attr("datetime")
-		parsedTime, err := time.Parse(time.RFC3339, postTime)
-		if err != nil || parsedTime.Before(s.startTime) {
-			// Skip the message if the timestamp is invalid or before the start time.
-			return
-		}
-
-		// Compile the search regular expression and check if the message text matches.
-		rx := regexp.MustCompile(s.SearchRegexp)
-		if rx.MatchString(messageText) && utf8.RuneCountInString(messageText) < 150 {
-			// If the message is new or expired, add it to the list of messages and mark it as seen.
-			if _, exists := s.seen[messageID]; !exists || time.Since(s.seen[messageID]) > s.expiry {
-				s.seen[messageID] = time.Now()
-				messages = append(messages, sources.Message{
-					ID:   messageID,
-					Text: s.formatMessage(messageText, messageID),
-				})
+	for _, p := range posts {
+		// Skip the post if it was already covered by the last processed one, or if it is too old to catch up on.
+		if p.Number <= lastID || p.Time.Before(oldest) {
+			continue
+		}
+
+		// Check if the post text matches and is not excluded.
+		decision := s.rules.Decide(s.matchText(p))
+		if s.Debug {
+			log.Printf("[DEBUG] %s: post %s: %s", s.Name, p.ID, decision)
+		}
+
+		if !decision.Accepted() {
+			continue
+		}
+
+		// Apply the length limits to the text that is going to be sent.
+		message, ok := s.message(p, decision.Hits, false)
+		if !ok {
+			if s.Debug {
+				log.Printf("[DEBUG] %s: post %s: dropped by length limits", s.Name, p.ID)
+			}
+
+			continue
+		}
+
+		// If the post is new, add it to the list of messages; it is marked as seen once it is queued.
+		seen, err := s.store.IsSeen(s.Name, p.ID)
+		if err != nil {
+			return nil, e.Wrap("can't check seen messages", err)
+		}
+
+		if seen {
+			continue
+		}
+
+		// Pick the destinations whose own rules the post matches too, and the subscribed chats.
+		if message.Chats, err = s.recipients(s.matchText(p)); err != nil {
+			return nil, e.Wrap("can't get subscribed chats", err)
+		}
+
+		if len(message.Chats) == 0 {
+			if s.Debug {
+				log.Printf("[DEBUG] %s: post %s: no matching destinations", s.Name, p.ID)
 			}
+
+			continue
 		}
-	})
+
+		messages = append(messages, message)
+	}
+
+	// The posts before the first message are processed, whether they were accepted or not.
+	processed := 0
+	for _, p := range posts {
+		if len(messages) > 0 && p.Number >= postNumber(messages[0].ID) {
+			break
+		}
+
+		processed = p.Number
+	}
+
+	if processed > 0 {
+		if err := s.store.SetLastPostID(s.Name, processed); err != nil {
+			return nil, e.Wrap("can't save last processed post", err)
+		}
+	}
 
 	return messages, nil
 }
 
+// message makes a message of the post. hits are the words that matched the rules of the source.
+// The returned flag is false if the post doesn't fit the length limits of the source,
+// unless force is set, in which case the text is truncated.
+func (s *Source) message(p post, hits []string, force bool) (sources.Message, bool) {
+	plain := s.cleanMessage(p.Text)
+
+	text, ok := s.fitLength(p.Text, plain, hits)
+	if !ok && !force {
+		return sources.Message{}, false
+	}
+
+	if !ok {
+		text = s.truncate(plain)
+	}
+
+	// The formatting of the post is kept only if its text was not shortened.
+	var formatted string
+	if text == plain {
+		formatted = s.cleanFormatted(p.HTML)
+	}
+
+	message := sources.Message{
+		ID:             p.ID,
+		Text:           text,
+		HTML:           formatted,
+		Media:          p.Media,
+		From:           p.From,
+		Time:           p.Time,
+		Hits:           hits,
+		Hash:           textHash(p.Text),
+		Classification: s.classifier.Classify(s.matchText(p)),
+	}
+
+	if p.Reply != nil {
+		message.Reply = p.Reply.Text
+	}
+
+	return message, true
+}
+
 // cleanMessage removes unwanted phrases from the message text and trims whitespace.
 // It iterates over the PhrasesToRemove and applies them to the message.
 func (s *Source) cleanMessage(text string) string {
@@ -142,7 +474,78 @@ func (s *Source) cleanMessage(text string) string {
 	return strings.TrimSpace(text)
 }
 
-// formatMessage formats a message by cleaning it and appending a source link.
-func (s *Source) formatMessage(text string, id string) string {
-	return fmt.Sprintf("%s\n\n<a href=\"https://t.me/%s\">Джерело</a>", s.cleanMessage(text), id)
+// cleanFormatted removes unwanted phrases from the formatted message text, where they occur escaped, and trims whitespace.
+func (s *Source) cleanFormatted(text string) string {
+	for _, phrase := range s.PhrasesToRemove {
+		text = strings.ReplaceAll(text, html.EscapeString(phrase), "")
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// Schedule returns the polling configuration of the source.
+func (s *Source) Schedule() scheduler.Config {
+	return scheduler.Config{
+		PollInterval: time.Duration(s.PollInterval),
+		MinInterval:  time.Duration(s.MinInterval),
+		MaxInterval:  time.Duration(s.MaxInterval),
+		Adaptive:     s.Adaptive,
+	}
+}
+
+// formatMessage renders a cleaned message with the template of the destination chat.
+// The formatted text of the message is used if it is available, otherwise the plain text is escaped.
+func (s *Source) formatMessage(message sources.Message, chatID int) (string, error) {
+	formatted := message.HTML
+	if formatted == "" {
+		formatted = html.EscapeString(message.Text)
+	}
+
+	tmpl := s.template
+	if r, ok := s.route(chatID); ok && r.Template != nil {
+		tmpl = r.Template
+	}
+
+	return tmpl.Render(templates.Data{
+		Source:   s.Name,
+		PostID:   message.ID,
+		PostURL:  "https://t.me/" + message.ID,
+		Time:     message.Time,
+		Text:     message.Text,
+		HTML:     formatted,
+		Hits:     message.Hits,
+		Threat:   string(message.Classification.Threat),
+		Severity: message.Classification.Severity.String(),
+		Label:    message.Classification.Label,
+		Reply:    message.Reply,
+		From:     message.From,
+	})
+}
+
+// postNumber extracts the numeric part of a post ID in the "channel/id" form of the data-post attribute.
+// It returns 0 if the ID has no numeric part.
+func postNumber(id string) int {
+	n, err := strconv.Atoi(id[strings.LastIndex(id, "/")+1:])
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
+
+// uniquePosts sorts the posts from oldest to newest and removes the ones occurring more than once.
+func uniquePosts(posts []post) []post {
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Number < posts[j].Number })
+
+	res := posts[:0]
+
+	for i, p := range posts {
+		if i > 0 && p.Number == posts[i-1].Number {
+			continue
+		}
+
+		res = append(res, p)
+	}
+
+	return res
 }
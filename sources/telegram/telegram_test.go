@@ -0,0 +1,194 @@
+package telegram
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"tg_alarm_bot/classifier"
+	"tg_alarm_bot/filter"
+	"tg_alarm_bot/outbox"
+	"tg_alarm_bot/sources"
+	"tg_alarm_bot/storage/files"
+	"tg_alarm_bot/templates"
+	"time"
+)
+
+// newTestSource creates a source that forwards the posts mentioning a Shahed to a single chat.
+func newTestSource(t *testing.T) *Source {
+	t.Helper()
+
+	store, err := files.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("files.New() error = %v", err)
+	}
+
+	m, err := filter.Keyword("шахед")
+	if err != nil {
+		t.Fatalf("filter.Keyword() error = %v", err)
+	}
+
+	rules, err := filter.NewFilter(m, false)
+	if err != nil {
+		t.Fatalf("filter.NewFilter() error = %v", err)
+	}
+
+	tmpl, err := templates.Compile("")
+	if err != nil {
+		t.Fatalf("templates.Compile() error = %v", err)
+	}
+
+	routes := []Route{{Destination: Destination{ChatID: -100}}}
+
+	return New(Source{Name: "test"}, rules, classifier.New(classifier.Config{}), routes, tmpl, nil, nil, store, nil)
+}
+
+func TestFilterCatchUp(t *testing.T) {
+	s := newTestSource(t)
+
+	if err := s.store.SetLastPostID(s.Name, 100); err != nil {
+		t.Fatalf("SetLastPostID() error = %v", err)
+	}
+
+	posts := []post{
+		{ID: "test/100", Number: 100, Time: time.Now().Add(-time.Minute), Text: "Шахед на Суми"},
+		{ID: "test/101", Number: 101, Time: time.Now().Add(-defaultBackfillAge - time.Hour), Text: "Шахед на Суми"},
+		{ID: "test/102", Number: 102, Time: time.Now().Add(-defaultBackfillAge + time.Hour), Text: "Шахед на Суми"},
+		{ID: "test/103", Number: 103, Time: time.Now().Add(-time.Minute), Text: "Шахед на Суми"},
+	}
+
+	messages, err := s.filter(posts)
+	if err != nil {
+		t.Fatalf("filter() error = %v", err)
+	}
+
+	var got []string
+	for _, m := range messages {
+		got = append(got, m.ID)
+	}
+
+	// The forwarded post and the post older than the backfill age are skipped.
+	if len(got) != 2 || got[0] != "test/102" || got[1] != "test/103" {
+		t.Errorf("filter() = %v, want [test/102 test/103]", got)
+	}
+
+	// The old post is processed, while the messages are left to Process.
+	if id, _ := s.store.LastPostID(s.Name); id != 101 {
+		t.Errorf("LastPostID() = %d, want 101", id)
+	}
+}
+
+func TestFilterRecordsRejectedPosts(t *testing.T) {
+	s := newTestSource(t)
+
+	posts := []post{
+		{ID: "test/200", Number: 200, Time: time.Now(), Text: "Відбій тривоги"},
+		{ID: "test/201", Number: 201, Time: time.Now(), Text: "Тиша"},
+	}
+
+	messages, err := s.filter(posts)
+	if err != nil {
+		t.Fatalf("filter() error = %v", err)
+	}
+
+	if len(messages) != 0 {
+		t.Errorf("filter() returned %d messages, want none", len(messages))
+	}
+
+	if id, _ := s.store.LastPostID(s.Name); id != 201 {
+		t.Errorf("LastPostID() = %d, want 201", id)
+	}
+}
+
+func TestFetchPostsSkipsOldGap(t *testing.T) {
+	// The posts following the stored one are long gone, so the latest page is requested instead.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("after") {
+			http.ServeFile(w, r, "testdata/channel.html")
+		} else {
+			http.ServeFile(w, r, "testdata/last_page.html")
+		}
+	}))
+	defer srv.Close()
+
+	s := newTestSource(t)
+	s.URL = srv.URL + "/s/glukhovalarm"
+	s.fetcher = NewFetcher()
+
+	if err := s.store.SetLastPostID(s.Name, 3000); err != nil {
+		t.Fatalf("SetLastPostID() error = %v", err)
+	}
+
+	posts, err := s.fetchPosts(context.Background())
+	if err != nil {
+		t.Fatalf("fetchPosts() error = %v", err)
+	}
+
+	if len(posts) != 2 || posts[0].Number != 3049 || posts[1].Number != 3051 {
+		t.Errorf("fetchPosts() returned %d posts, want the 2 posts of the latest page", len(posts))
+	}
+}
+
+func TestProcessRetriesFailedPush(t *testing.T) {
+	s := newTestSource(t)
+
+	dir := t.TempDir()
+
+	queue, err := outbox.Open(dir)
+	if err != nil {
+		t.Fatalf("outbox.Open() error = %v", err)
+	}
+
+	s.outbox = outbox.New(queue, nil, 1, s.store)
+	s.lastPost = 102
+
+	message := sources.Message{ID: "test/101", Text: "Шахед на Суми", Chats: []int{-100, -200}}
+
+	// The pending items can't be stored while their directory is missing.
+	pending := filepath.Join(dir, "pending")
+	if err := os.Remove(pending); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Process(context.Background(), message); err == nil {
+		t.Fatal("Process() error = nil, want an error")
+	}
+
+	if seen, _ := s.store.IsSeen(s.Name, message.ID); seen {
+		t.Error("IsSeen() = true after a failed push, want false")
+	}
+
+	if s.lastPost != 100 {
+		t.Errorf("lastPost = %d after a failed push, want 100", s.lastPost)
+	}
+
+	// A later post of the batch doesn't move the stored cursor past the failed one.
+	if err := os.Mkdir(pending, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Process(context.Background(), sources.Message{ID: "test/102", Text: "Шахед", Chats: []int{-100}}); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if id, _ := s.store.LastPostID(s.Name); id != 0 {
+		t.Errorf("LastPostID() = %d, want 0", id)
+	}
+
+	// The post is downloaded and processed again on the next fetch.
+	s.lastPost = 102
+
+	if err := s.Process(context.Background(), message); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if seen, _ := s.store.IsSeen(s.Name, message.ID); !seen {
+		t.Error("IsSeen() = false after queueing, want true")
+	}
+
+	if id, _ := s.store.LastPostID(s.Name); id != 101 {
+		t.Errorf("LastPostID() = %d, want 101", id)
+	}
+}
@@ -1,14 +1,55 @@
 package sources
 
+import (
+	"context"
+	"tg_alarm_bot/classifier"
+	"time"
+)
+
+// Fetcher defines an interface for fetching new messages from a source.
 type Fetcher interface {
-	Fetch() ([]Message, error)
+	Fetch(ctx context.Context) ([]Message, error)
 }
 
+// Processor defines an interface for processing messages fetched from a source.
 type Processor interface {
-	Process(message Message) error
+	Process(ctx context.Context, message Message) error
 }
 
+// Message is a message fetched from a source. Text holds the cleaned message text without any formatting,
+// HTML holds the same text with the formatting supported by the Telegram Bot API, or is empty if the formatting
+// was lost, e.g. because the text was shortened, and Media holds the attached media files. Reply holds the text
+// of the post the message replies to, From the name of the channel the message was forwarded from,
+// and Chats the IDs of the destination chats of the message. Time is the publication time of the post,
+// and Hits the keywords and patterns that matched it.
+// Classification tells what kind of threat the message announces. Hash identifies the source text
+// the message was made of, Edit marks the new version of an already forwarded message, and Deleted marks
+// an already forwarded message deleted from the source, of which only the ID is set.
 type Message struct {
-	ID   string
-	Text string
+	ID             string
+	Text           string
+	HTML           string
+	Media          []Media
+	Reply          string
+	From           string
+	Chats          []int
+	Time           time.Time
+	Hits           []string
+	Hash           string
+	Edit           bool
+	Deleted        bool
+	Classification classifier.Classification
+}
+
+// Types of media.
+const (
+	MediaPhoto    = "photo"
+	MediaVideo    = "video"
+	MediaDocument = "document"
+)
+
+// Media is a photo, video or document attached to a message.
+type Media struct {
+	Type string // Type of the media: "photo", "video" or "document".
+	URL  string // URL of the media file.
 }
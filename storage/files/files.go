@@ -0,0 +1,296 @@
+// Package files implements the storage interfaces on top of JSON files on the local disk.
+// Every change is written to a temporary file first and then atomically renamed over the
+// previous state, so a crash in the middle of a write never corrupts the stored data.
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"tg_alarm_bot/lib/e"
+	"tg_alarm_bot/lib/file"
+	"tg_alarm_bot/storage"
+	"time"
+)
+
+const (
+	// defaultPerm is the permission used when creating the storage directory.
+	defaultPerm = 0774
+	// seenFile is the name of the file holding the seen posts of every source.
+	seenFile = "seen.json"
+	// subscriptionsFile is the name of the file holding the subscriptions of every chat.
+	subscriptionsFile = "subscriptions.json"
+)
+
+// Storage is a file based implementation of storage.SeenStore, storage.ForwardStore and storage.SubscriptionStore.
+// It keeps the whole state in memory and flushes it to disk after every change.
+type Storage struct {
+	basePath      string
+	mu            sync.Mutex
+	sources       map[string]*sourceState
+	subscriptions map[int][]string
+}
+
+// sourceState holds the persisted state of a single source.
+type sourceState struct {
+	LastPostID int                          `json:"last_post_id"`       // Numeric ID of the newest processed post.
+	Seen       map[string]time.Time         `json:"seen"`               // Seen posts with the time they were marked.
+	Forwards   map[string][]storage.Forward `json:"forwards,omitempty"` // Forwarded copies of the posts.
+}
+
+// New creates a new Storage rooted at basePath and loads the previously saved state, if any.
+func New(basePath string) (*Storage, error) {
+	s := &Storage{
+		basePath:      basePath,
+		sources:       make(map[string]*sourceState),
+		subscriptions: make(map[int][]string),
+	}
+
+	if err := readJSON(filepath.Join(basePath, seenFile), &s.sources); err != nil {
+		return nil, e.Wrap("can't load seen posts", err)
+	}
+
+	if err := readJSON(filepath.Join(basePath, subscriptionsFile), &s.subscriptions); err != nil {
+		return nil, e.Wrap("can't load subscriptions", err)
+	}
+
+	return s, nil
+}
+
+// IsSeen reports whether the post has already been handled for the source.
+func (s *Storage) IsSeen(source, postID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.sources[source]
+	if !ok {
+		return false, nil
+	}
+
+	_, ok = st.Seen[postID]
+
+	return ok, nil
+}
+
+// MarkSeen records the post as handled for the source and saves the state.
+func (s *Storage) MarkSeen(source, postID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source(source).Seen[postID] = time.Now()
+
+	return s.save()
+}
+
+// Prune removes seen posts of the source that were marked more than expiry ago,
+// and the forwarded copies of posts that were not updated for as long.
+// The state is saved only if something was removed.
+func (s *Storage) Prune(source string, expiry time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.sources[source]
+	if !ok {
+		return nil
+	}
+
+	changed := false
+
+	for id, timestamp := range st.Seen {
+		if time.Since(timestamp) > expiry {
+			delete(st.Seen, id)
+			changed = true
+		}
+	}
+
+	for id, forwards := range st.Forwards {
+		kept := forwards[:0]
+		for _, f := range forwards {
+			if time.Since(f.Time) <= expiry {
+				kept = append(kept, f)
+			}
+		}
+
+		if len(kept) < len(forwards) {
+			changed = true
+		}
+
+		if len(kept) == 0 {
+			delete(st.Forwards, id)
+		} else {
+			st.Forwards[id] = kept
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return s.save()
+}
+
+// LastPostID returns the numeric ID of the newest post of the source processed so far.
+func (s *Storage) LastPostID(source string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.sources[source]
+	if !ok {
+		return 0, nil
+	}
+
+	return st.LastPostID, nil
+}
+
+// SetLastPostID records the numeric ID of the newest post of the source processed so far.
+// IDs lower than the already stored one are ignored, so the value never moves backwards.
+func (s *Storage) SetLastPostID(source string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.source(source)
+	if id <= st.LastPostID {
+		return nil
+	}
+
+	st.LastPostID = id
+
+	return s.save()
+}
+
+// Forwards returns the forwarded copies of the post of the source.
+func (s *Storage) Forwards(source, postID string) ([]storage.Forward, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.sources[source]
+	if !ok {
+		return nil, nil
+	}
+
+	return append([]storage.Forward(nil), st.Forwards[postID]...), nil
+}
+
+// SaveForward records the forwarded copy of the post of the source, replacing the previously
+// recorded copy in the same chat, and saves the state.
+func (s *Storage) SaveForward(source, postID string, f storage.Forward) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.source(source)
+
+	forwards := st.Forwards[postID]
+	for i := range forwards {
+		if forwards[i].ChatID == f.ChatID {
+			forwards[i] = f
+			return s.save()
+		}
+	}
+
+	st.Forwards[postID] = append(forwards, f)
+
+	return s.save()
+}
+
+// ForwardedPosts returns the IDs of the posts of the source that have forwarded copies.
+func (s *Storage) ForwardedPosts(source string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.sources[source]
+	if !ok {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(st.Forwards))
+	for id := range st.Forwards {
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// DeleteForwards stops tracking the forwarded copies of the post of the source and saves the state.
+func (s *Storage) DeleteForwards(source, postID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.sources[source]
+	if !ok {
+		return nil
+	}
+
+	if _, ok := st.Forwards[postID]; !ok {
+		return nil
+	}
+
+	delete(st.Forwards, postID)
+
+	return s.save()
+}
+
+// source returns the state of the source, creating it if necessary. The caller must hold the lock.
+func (s *Storage) source(name string) *sourceState {
+	st, ok := s.sources[name]
+	if !ok {
+		st = &sourceState{}
+		s.sources[name] = st
+	}
+
+	if st.Seen == nil {
+		st.Seen = make(map[string]time.Time)
+	}
+
+	if st.Forwards == nil {
+		st.Forwards = make(map[string][]storage.Forward)
+	}
+
+	return st
+}
+
+// save writes the seen posts of every source to disk. The caller must hold the lock.
+func (s *Storage) save() error {
+	if err := writeJSON(filepath.Join(s.basePath, seenFile), s.sources); err != nil {
+		return e.Wrap("can't save seen posts", err)
+	}
+
+	return nil
+}
+
+// saveSubscriptions writes the subscriptions of every chat to disk. The caller must hold the lock.
+func (s *Storage) saveSubscriptions() error {
+	if err := writeJSON(filepath.Join(s.basePath, subscriptionsFile), s.subscriptions); err != nil {
+		return e.Wrap("can't save subscriptions", err)
+	}
+
+	return nil
+}
+
+// readJSON decodes the JSON file at path into v. A missing file is not an error and leaves v untouched.
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON atomically replaces the file at path with the JSON encoding of v.
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), defaultPerm); err != nil {
+		return err
+	}
+
+	return file.WriteAtomic(path, data, 0600)
+}
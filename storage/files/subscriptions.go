@@ -0,0 +1,77 @@
+package files
+
+import (
+	"slices"
+	"sort"
+)
+
+// Subscribe subscribes the chat to the topic and saves the subscriptions.
+// Subscribing to the same topic again is not an error.
+func (s *Storage) Subscribe(chatID int, topic string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	topics := s.subscriptions[chatID]
+	if slices.Contains(topics, topic) {
+		return nil
+	}
+
+	topics = append(topics, topic)
+	sort.Strings(topics)
+	s.subscriptions[chatID] = topics
+
+	return s.saveSubscriptions()
+}
+
+// Unsubscribe unsubscribes the chat from the topic, or from every topic if topic is empty,
+// saves the subscriptions and reports whether the chat was subscribed.
+func (s *Storage) Unsubscribe(chatID int, topic string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	topics, ok := s.subscriptions[chatID]
+	if !ok {
+		return false, nil
+	}
+
+	if topic != "" {
+		i := slices.Index(topics, topic)
+		if i < 0 {
+			return false, nil
+		}
+
+		topics = slices.Delete(topics, i, i+1)
+	}
+
+	if topic == "" || len(topics) == 0 {
+		delete(s.subscriptions, chatID)
+	} else {
+		s.subscriptions[chatID] = topics
+	}
+
+	return true, s.saveSubscriptions()
+}
+
+// Subscriptions returns the topics the chat is subscribed to, sorted by name.
+func (s *Storage) Subscriptions(chatID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.subscriptions[chatID]), nil
+}
+
+// Subscribers returns the subscribed chats of every topic.
+func (s *Storage) Subscribers() (map[string][]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[string][]int)
+
+	for chatID, topics := range s.subscriptions {
+		for _, topic := range topics {
+			res[topic] = append(res[topic], chatID)
+		}
+	}
+
+	return res, nil
+}
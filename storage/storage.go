@@ -0,0 +1,66 @@
+// Package storage defines the interfaces used to persist the bot state between restarts,
+// so that already forwarded alerts are neither lost nor re-posted after the process is restarted.
+package storage
+
+import "time"
+
+// SeenStore defines an interface for tracking which posts of a source have already been handled.
+// Sources are identified by their name and posts by the "channel/id" value of the data-post attribute.
+type SeenStore interface {
+	// IsSeen reports whether the post has already been handled for the source.
+	IsSeen(source, postID string) (bool, error)
+	// MarkSeen records the post as handled for the source.
+	MarkSeen(source, postID string) error
+	// Prune removes seen posts of the source that were marked more than expiry ago.
+	Prune(source string, expiry time.Duration) error
+	// LastPostID returns the numeric ID of the newest post of the source processed so far,
+	// or 0 if nothing has been processed yet.
+	LastPostID(source string) (int, error)
+	// SetLastPostID records the numeric ID of the newest post of the source processed so far.
+	SetLastPostID(source string, id int) error
+}
+
+// Forward describes the copy of a source post forwarded to a destination chat.
+type Forward struct {
+	ChatID    int       `json:"chat_id"`           // ID of the destination chat.
+	MessageID int       `json:"message_id"`        // ID of the forwarded message in the destination chat.
+	Caption   bool      `json:"caption,omitempty"` // Whether the text was sent as the caption of media.
+	Hash      string    `json:"hash"`              // Hash of the post text the copy was made from.
+	Text      string    `json:"text,omitempty"`    // Text of the copy as it was sent.
+	Time      time.Time `json:"time"`              // Time the copy was sent or last updated.
+}
+
+// ForwardStore defines an interface for tracking the forwarded copies of source posts,
+// so that the copies can be updated when the posts are edited.
+type ForwardStore interface {
+	// Forwards returns the forwarded copies of the post of the source.
+	Forwards(source, postID string) ([]Forward, error)
+	// SaveForward records the forwarded copy of the post of the source,
+	// replacing the previously recorded copy in the same chat.
+	SaveForward(source, postID string, f Forward) error
+	// ForwardedPosts returns the IDs of the posts of the source that have forwarded copies.
+	ForwardedPosts(source string) ([]string, error)
+	// DeleteForwards stops tracking the forwarded copies of the post of the source.
+	DeleteForwards(source, postID string) error
+}
+
+// SubscriptionStore defines an interface for keeping the topics users subscribed to in private chats.
+// Topics are names of shared rules or regions, and chats are identified by their IDs.
+type SubscriptionStore interface {
+	// Subscribe subscribes the chat to the topic. Subscribing to the same topic again is not an error.
+	Subscribe(chatID int, topic string) error
+	// Unsubscribe unsubscribes the chat from the topic, or from every topic if topic is empty,
+	// and reports whether the chat was subscribed.
+	Unsubscribe(chatID int, topic string) (bool, error)
+	// Subscriptions returns the topics the chat is subscribed to, sorted by name.
+	Subscriptions(chatID int) ([]string, error)
+	// Subscribers returns the subscribed chats of every topic.
+	Subscribers() (map[string][]int, error)
+}
+
+// Store combines the stores used by the sources.
+type Store interface {
+	SeenStore
+	ForwardStore
+	SubscriptionStore
+}
@@ -0,0 +1,148 @@
+// Package subscriptions lets users receive alerts in their private chats with the bot.
+// Users subscribe to topics, which are names of shared rules or regions; an alert is sent to
+// every chat subscribed to a topic the alert text matches.
+package subscriptions
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"tg_alarm_bot/filter"
+	"tg_alarm_bot/lib/e"
+	"tg_alarm_bot/storage"
+)
+
+// ErrInvalidTopic is returned when a topic can't be subscribed to.
+var ErrInvalidTopic = errors.New("invalid topic")
+
+// Compiler returns the matcher of a topic.
+type Compiler func(topic string) (filter.Matcher, error)
+
+// Subscriptions manages the subscriptions kept in a store and matches alerts against them.
+// It is safe for concurrent use by the command handlers and the source consumers.
+type Subscriptions struct {
+	store    storage.SubscriptionStore
+	compile  Compiler
+	mu       sync.Mutex
+	matchers map[string]filter.Matcher // Compiled matchers of the topics.
+}
+
+// New creates a new Subscriptions kept in store, with the topics compiled by compile.
+func New(store storage.SubscriptionStore, compile Compiler) *Subscriptions {
+	return &Subscriptions{
+		store:    store,
+		compile:  compile,
+		matchers: make(map[string]filter.Matcher),
+	}
+}
+
+// Subscribe subscribes the chat to the topic and returns the topic as it was saved.
+// It fails with ErrInvalidTopic if the topic can't be compiled.
+func (s *Subscriptions) Subscribe(chatID int, topic string) (string, error) {
+	topic = Normalize(topic)
+
+	if _, err := s.matcher(topic); err != nil {
+		return "", e.Wrap("can't subscribe", errors.Join(ErrInvalidTopic, err))
+	}
+
+	if err := s.store.Subscribe(chatID, topic); err != nil {
+		return "", e.Wrap("can't subscribe", err)
+	}
+
+	return topic, nil
+}
+
+// Unsubscribe unsubscribes the chat from the topic, or from every topic if topic is empty,
+// and reports whether the chat was subscribed.
+func (s *Subscriptions) Unsubscribe(chatID int, topic string) (bool, error) {
+	ok, err := s.store.Unsubscribe(chatID, Normalize(topic))
+	if err != nil {
+		return false, e.Wrap("can't unsubscribe", err)
+	}
+
+	return ok, nil
+}
+
+// List returns the topics the chat is subscribed to.
+func (s *Subscriptions) List(chatID int) ([]string, error) {
+	topics, err := s.store.Subscriptions(chatID)
+	if err != nil {
+		return nil, e.Wrap("can't list subscriptions", err)
+	}
+
+	return topics, nil
+}
+
+// Chats returns the IDs of the chats subscribed to a topic the text matches, sorted.
+// Topics that no longer compile, e.g. because their rule was removed from the config, are skipped.
+func (s *Subscriptions) Chats(text string) ([]int, error) {
+	subscribers, err := s.store.Subscribers()
+	if err != nil {
+		return nil, e.Wrap("can't get subscribers", err)
+	}
+
+	set := make(map[int]bool)
+
+	for topic, chats := range subscribers {
+		m, err := s.matcher(topic)
+		if err != nil {
+			continue
+		}
+
+		if !m.Match(text).Matched {
+			continue
+		}
+
+		for _, chatID := range chats {
+			set[chatID] = true
+		}
+	}
+
+	res := make([]int, 0, len(set))
+	for chatID := range set {
+		res = append(res, chatID)
+	}
+
+	sort.Ints(res)
+
+	return res, nil
+}
+
+// Blocked unsubscribes a chat that blocked the bot from every topic.
+func (s *Subscriptions) Blocked(chatID int) {
+	ok, err := s.store.Unsubscribe(chatID, "")
+	if err != nil {
+		log.Printf("[ERR] subscriptions: can't unsubscribe chat %d: %s", chatID, err)
+		return
+	}
+
+	if ok {
+		log.Printf("subscriptions: chat %d blocked the bot, unsubscribed", chatID)
+	}
+}
+
+// matcher returns the compiled matcher of the topic.
+func (s *Subscriptions) matcher(topic string) (filter.Matcher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, ok := s.matchers[topic]; ok {
+		return m, nil
+	}
+
+	m, err := s.compile(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	s.matchers[topic] = m
+
+	return m, nil
+}
+
+// Normalize prepares a topic typed by a user for saving: it trims the spaces and lowercases it.
+func Normalize(topic string) string {
+	return strings.ToLower(strings.Join(strings.Fields(topic), " "))
+}
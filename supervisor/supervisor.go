@@ -0,0 +1,364 @@
+// Package supervisor runs the consumers of the bot and keeps them alive.
+// It restarts consumers that fail or panic, backs off consumers whose fetches keep failing,
+// and tracks the state of every consumer for status reporting. Consumers can be added, removed,
+// paused and resumed while the bot is running.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"tg_alarm_bot/consumer"
+	"tg_alarm_bot/lib/backoff"
+	"time"
+)
+
+const (
+	// degradedAfter is the number of consecutive failures after which a consumer is marked degraded.
+	degradedAfter = 3
+	// downAfter is the number of consecutive failures after which a consumer is marked down.
+	downAfter = 10
+	// baseBackoff is the delay after the first failure; it doubles with every consecutive failure.
+	baseBackoff = 2 * time.Second
+	// maxBackoff caps the delay between failing fetches and restarts.
+	maxBackoff = 5 * time.Minute
+)
+
+// State represents the health of a consumer.
+type State int
+
+const (
+	// Running means the consumer works normally.
+	Running State = iota
+	// Degraded means the recent fetches of the consumer failed.
+	Degraded
+	// Down means the consumer failed many times in a row.
+	Down
+	// Restarting means the consumer stopped with an error or panic and waits to be restarted.
+	Restarting
+	// Stopped means the consumer has finished.
+	Stopped
+	// Paused means the consumer was stopped on request and waits to be resumed.
+	Paused
+)
+
+// ErrUnknownConsumer is returned when a consumer with the given name doesn't exist.
+var ErrUnknownConsumer = errors.New("unknown consumer")
+
+// String returns the human-readable name of the state.
+func (s State) String() string {
+	switch s {
+	case Running:
+		return "running"
+	case Degraded:
+		return "degraded"
+	case Down:
+		return "down"
+	case Restarting:
+		return "restarting"
+	case Stopped:
+		return "stopped"
+	case Paused:
+		return "paused"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+// Factory creates a consumer that reports the outcome of its fetches to the given reporter.
+// It is called every time the consumer is (re)started.
+type Factory func(reporter consumer.Reporter) consumer.Consumer
+
+// Status is a snapshot of the state of a supervised consumer.
+type Status struct {
+	Name        string    // Name of the consumer.
+	State       State     // Current state.
+	Failures    int       // Number of consecutive failures.
+	Restarts    int       // Number of restarts after errors or panics.
+	LastError   string    // Last error reported by the consumer.
+	LastSuccess time.Time // Time of the last successful fetch.
+	Since       time.Time // Time the consumer entered the current state.
+}
+
+// Supervisor owns a set of consumers, each running in its own goroutine.
+type Supervisor struct {
+	mu    sync.Mutex
+	units map[string]*unit
+	wg    sync.WaitGroup
+}
+
+// unit is a single supervised consumer. It implements consumer.Reporter.
+type unit struct {
+	mu      sync.Mutex
+	status  Status
+	ctx     context.Context    // Context the consumer was added with.
+	factory Factory            // Factory the consumer is created with.
+	cancel  context.CancelFunc // Stops the running consumer, or nil if it is paused.
+	done    chan struct{}      // Closed when the running consumer has stopped.
+}
+
+// New creates an empty Supervisor.
+func New() *Supervisor {
+	return &Supervisor{
+		units: make(map[string]*unit),
+	}
+}
+
+// Add starts a consumer created by factory under the given name and keeps it running until the context is done.
+// A consumer that returns an error or panics is recreated and restarted after a backoff delay.
+func (s *Supervisor) Add(ctx context.Context, name string, factory Factory) error {
+	return s.add(ctx, name, factory, false)
+}
+
+// AddPaused adds a consumer like Add, but doesn't start it until it is resumed.
+func (s *Supervisor) AddPaused(ctx context.Context, name string, factory Factory) error {
+	return s.add(ctx, name, factory, true)
+}
+
+// add registers the consumer and starts it unless paused is set.
+func (s *Supervisor) add(ctx context.Context, name string, factory Factory, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.units[name]; ok {
+		return fmt.Errorf("consumer %q already exists", name)
+	}
+
+	u := &unit{status: Status{Name: name, State: Running, Since: time.Now()}, ctx: ctx, factory: factory}
+	s.units[name] = u
+
+	if paused {
+		u.status.State = Paused
+		return nil
+	}
+
+	s.start(u)
+
+	return nil
+}
+
+// Remove stops the consumer with the given name, waits until it has finished its batch in flight and forgets it.
+// The other consumers can be managed and reported on while it waits.
+func (s *Supervisor) Remove(name string) error {
+	s.mu.Lock()
+
+	u, ok := s.units[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownConsumer, name)
+	}
+
+	delete(s.units, name)
+	done := u.cancelRun()
+
+	s.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+
+	log.Printf("supervisor: %s removed", name)
+
+	return nil
+}
+
+// Pause stops the consumer with the given name and waits until it has finished its batch in flight.
+// The consumer keeps its status and can be started again with Resume. Pausing a paused consumer does nothing.
+// The other consumers can be managed and reported on while it waits.
+func (s *Supervisor) Pause(name string) error {
+	s.mu.Lock()
+
+	u, ok := s.units[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownConsumer, name)
+	}
+
+	done := u.cancelRun()
+
+	s.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+
+	<-done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The consumer may have been resumed while it was finishing its batch.
+	if u.cancel == nil {
+		u.setState(Paused)
+	}
+
+	return nil
+}
+
+// Resume starts the paused consumer with the given name again. Resuming a running consumer does nothing.
+func (s *Supervisor) Resume(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.units[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownConsumer, name)
+	}
+
+	if u.cancel == nil {
+		u.mu.Lock()
+		u.status.Failures = 0
+		u.mu.Unlock()
+
+		u.setState(Running)
+		s.start(u)
+	}
+
+	return nil
+}
+
+// start runs the consumer of the unit in its own goroutine. The caller must hold the lock.
+func (s *Supervisor) start(u *unit) {
+	ctx, cancel := context.WithCancel(u.ctx)
+	u.cancel, u.done = cancel, make(chan struct{})
+
+	s.wg.Add(1)
+	go func(done chan struct{}) {
+		defer s.wg.Done()
+		defer close(done)
+
+		u.run(ctx, u.factory)
+	}(u.done)
+}
+
+// Statuses returns the status of every consumer ordered by name.
+func (s *Supervisor) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]Status, 0, len(s.units))
+
+	for _, u := range s.units {
+		u.mu.Lock()
+		res = append(res, u.status)
+		u.mu.Unlock()
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+// Wait blocks until all the consumers have stopped.
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// cancelRun cancels the running consumer of the unit without waiting for it and returns the channel
+// closed when it has finished, or nil if the consumer was not running. The caller must hold the lock of the supervisor.
+func (u *unit) cancelRun() chan struct{} {
+	if u.cancel == nil {
+		return nil
+	}
+
+	done := u.done
+
+	u.cancel()
+	u.cancel, u.done = nil, nil
+
+	return done
+}
+
+// run starts the consumer and restarts it with a growing delay whenever it fails, until the context is done.
+func (u *unit) run(ctx context.Context, factory Factory) {
+	defer u.setState(Stopped)
+
+	for ctx.Err() == nil {
+		err := u.start(ctx, factory)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			log.Printf("supervisor: %s finished", u.status.Name)
+			return
+		}
+
+		u.mu.Lock()
+		delay := backoff.Exponential(u.status.Restarts, baseBackoff, maxBackoff)
+		u.status.Restarts++
+		u.status.LastError = err.Error()
+		u.mu.Unlock()
+
+		u.setState(Restarting)
+		log.Printf("[ERR] supervisor: %s stopped: %s, restarting in %s", u.status.Name, err, delay)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+		case <-t.C:
+		}
+		t.Stop()
+
+		u.setState(Running)
+	}
+}
+
+// start creates and runs the consumer, converting a panic into an error.
+func (u *unit) start(ctx context.Context, factory Factory) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	return factory(u).Start(ctx)
+}
+
+// Success implements consumer.Reporter. It resets the consecutive failures of the consumer.
+func (u *unit) Success() {
+	u.mu.Lock()
+	u.status.Failures = 0
+	u.status.LastSuccess = time.Now()
+	u.mu.Unlock()
+
+	u.setState(Running)
+}
+
+// Failure implements consumer.Reporter. It counts the failure, updates the state of the consumer
+// and returns a jittered exponential delay based on the number of consecutive failures.
+func (u *unit) Failure(err error) time.Duration {
+	u.mu.Lock()
+	u.status.Failures++
+	u.status.LastError = err.Error()
+	failures := u.status.Failures
+	u.mu.Unlock()
+
+	switch {
+	case failures >= downAfter:
+		u.setState(Down)
+	case failures >= degradedAfter:
+		u.setState(Degraded)
+	}
+
+	return backoff.Exponential(failures-1, baseBackoff, maxBackoff)
+}
+
+// setState changes the state of the consumer, logging the transition.
+func (u *unit) setState(state State) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.status.State == state {
+		return
+	}
+
+	log.Printf("supervisor: %s is %s (was %s)", u.status.Name, state, u.status.State)
+
+	u.status.State = state
+	u.status.Since = time.Now()
+}
@@ -0,0 +1,108 @@
+// Package templates renders forwarded alerts with Go text templates.
+//
+// Templates produce the HTML subset supported by the Telegram Bot API. Text fields are escaped with the "escape"
+// helper, while HTML holds the text of the post already converted to that subset. A template is validated
+// when it is compiled by rendering it with sample data, so mistakes like misspelled fields are reported at startup.
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+	"tg_alarm_bot/lib/runes"
+	"time"
+)
+
+// Default is the template used when none is configured: the threat label, the text of the post,
+// the context of forwards and replies, and a link to the post.
+const Default = `{{with .Label}}{{.}} {{end}}{{.HTML}}
+{{with .From}}
+<i>↪ переслано з: {{escape .}}</i>{{end}}{{with .Reply}}
+<i>↪ у відповідь на: {{truncate 100 . | escape}}</i>{{end}}
+{{link .PostURL "Джерело"}}`
+
+// Data holds the fields available to templates.
+type Data struct {
+	Source   string    // Name of the source.
+	PostID   string    // ID of the post in the "channel/id" form.
+	PostURL  string    // Link to the post.
+	Time     time.Time // Time the post was published.
+	Text     string    // Plain text of the message; must be escaped.
+	HTML     string    // Text of the message formatted for Telegram; safe to output as is.
+	Hits     []string  // Keywords and patterns that matched the post; must be escaped.
+	Threat   string    // Type of the threat, e.g. "ballistic".
+	Severity string    // Severity of the threat: "low", "medium", "high" or "critical".
+	Label    string    // Label of the threat, e.g. an emoji.
+	Reply    string    // Plain text of the post the message replies to; must be escaped.
+	From     string    // Name of the channel the post was forwarded from; must be escaped.
+}
+
+// funcs are the helpers available to templates.
+var funcs = template.FuncMap{
+	"escape":   html.EscapeString,
+	"truncate": func(n int, text string) string { return runes.Truncate(text, n) },
+	"join":     strings.Join,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"date":     func(layout string, t time.Time) string { return t.Local().Format(layout) },
+	"link": func(url, text string) string {
+		return `<a href="` + html.EscapeString(url) + `">` + html.EscapeString(text) + `</a>`
+	},
+	"bold":   func(s string) string { return "<b>" + html.EscapeString(s) + "</b>" },
+	"italic": func(s string) string { return "<i>" + html.EscapeString(s) + "</i>" },
+}
+
+// sample is the data templates are validated with.
+var sample = Data{
+	Source:   "source",
+	PostID:   "channel/1",
+	PostURL:  "https://t.me/channel/1",
+	Time:     time.Now(),
+	Text:     "text",
+	HTML:     "text",
+	Hits:     []string{"hit"},
+	Threat:   "unknown",
+	Severity: "medium",
+	Label:    "⚠️",
+	Reply:    "reply",
+	From:     "channel",
+}
+
+// Template is a compiled message template.
+type Template struct {
+	tmpl *template.Template
+}
+
+// Compile parses the template and validates it by rendering the sample data.
+// An empty source compiles the Default template.
+func Compile(src string) (*Template, error) {
+	if src == "" {
+		src = Default
+	}
+
+	tmpl, err := template.New("message").Funcs(funcs).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse template: %w", err)
+	}
+
+	t := &Template{tmpl: tmpl}
+
+	if _, err := t.Render(sample); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Render renders the data with the template. Leading and trailing whitespace is trimmed.
+func (t *Template) Render(data Data) (string, error) {
+	var buf bytes.Buffer
+
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("can't render template: %w", err)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}